@@ -3,68 +3,206 @@ package account
 import (
 	"account/infrastructure"
 	"account/models"
+	"account/tracing"
 	"context"
 	"errors"
 	"fmt"
 	"net/http"
 	"net/url"
 	"time"
+
+	"github.com/google/uuid"
 )
 
+// Version - the version of the client library
+const Version = "0.1"
+
 const (
-	version        = "0.1"
 	apiVersion     = "v1"
-	userAgent      = "go-account/" + version
+	userAgent      = "go-account/" + Version
 	defaultBaseURL = "http://localhost:8080"
 )
 
 // Service - handles communication with the account endpoint
 type Service struct {
-	http *infrastructure.HTTP
+	http              *infrastructure.HTTP
+	inflight          *group
+	tracer            tracing.Tracer
+	attempts          int
+	backoff           time.Duration
+	recoverDuplicates bool
+	generateIDs       bool
+	organisationID    string
+	strictEnums       bool
+	validators        []Validator
+}
+
+// Validator - checks an account before Create sends it, modulus.Checker
+// checks UK sort codes and account numbers
+type Validator interface {
+	Validate(a models.Account) error
 }
 
 // NewService - initialise the service along with the client it will use for
 // making request to the account api
-func NewService(h *infrastructure.HTTP) *Service {
-	return &Service{
-		http: validateInjectedHTTPOrDefault(h),
+func NewService(h *infrastructure.HTTP, opts ...Option) *Service {
+	s := &Service{
+		http:        validateInjectedHTTPOrDefault(h),
+		inflight:    &group{},
+		tracer:      tracing.Noop,
+		attempts:    1,
+		generateIDs: true,
 	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
 }
 
 // GetByID - get new account by ID
 func (s *Service) GetByID(id string) (*models.Account, error) {
+	return s.GetByIDContext(s.http.Context, id)
+}
+
+// GetByIDContext - get account by ID, bound to ctx. Concurrent calls for the
+// same ID share a single request to the account api, each caller gets its
+// own copy of the account and can give up on ctx without affecting the others
+func (s *Service) GetByIDContext(ctx context.Context, id string) (_ *models.Account, err error) {
+	ctx, span := s.startSpan(ctx, "get", id)
+	defer func() { endSpan(span, err) }()
+
 	if len(id) <= 0 {
 		return nil, errors.New("Invalid id argument")
 	}
-	account := &models.Account{}
-	getAccountPath := fmt.Sprintf("%s/organisation/accounts/%s", apiVersion, id)
-	err := s.http.Get(getAccountPath, account)
-	return account, err
+	account, err := s.inflight.do(ctx, id, func(ctx context.Context) (*models.Account, error) {
+		account := &models.Account{}
+		getAccountPath := fmt.Sprintf("%s/organisation/accounts/%s", apiVersion, id)
+		err := s.http.GetContext(ctx, getAccountPath, account)
+		return account, err
+	})
+	if err != nil {
+		return account, err
+	}
+	if err = s.checkEnums(*account); err != nil {
+		return nil, err
+	}
+	return account, nil
 }
 
 // Create - create a new account
 func (s *Service) Create(a models.Account) (*models.Account, error) {
+	return s.CreateContext(s.http.Context, a)
+}
+
+// CreateContext - create a new account, bound to ctx. The request carries an
+// Idempotency-Key (the one set with infrastructure.WithIdempotencyKey, or a
+// new one) which is kept across the retries configured with WithRetries
+func (s *Service) CreateContext(ctx context.Context, a models.Account) (_ *models.Account, err error) {
+	ctx, span := s.startSpan(ctx, "create", a.ID)
+	defer func() { endSpan(span, err) }()
+
+	if a, err = s.prepareIDs(a); err != nil {
+		return nil, err
+	}
+	span.SetAttribute("account.id", a.ID)
+	// the account api stamps these itself
+	a.CreatedOn, a.ModifiedOn = models.Timestamp{}, models.Timestamp{}
+	if err = s.checkEnums(a); err != nil {
+		return nil, err
+	}
+	for _, v := range s.validators {
+		if err = v.Validate(a); err != nil {
+			return nil, err
+		}
+	}
+	if len(infrastructure.IdempotencyKey(ctx)) == 0 {
+		ctx = infrastructure.WithIdempotencyKey(ctx, uuid.New().String())
+	}
+
 	account := &models.Account{}
+	createAccountPath := fmt.Sprintf("%s/organisation/accounts", apiVersion)
+	err = s.retry(ctx, func(ctx context.Context) error {
+		return s.http.PostContext(ctx, createAccountPath, a, account)
+	})
+	if err != nil && s.recoverDuplicates && isDuplicate(err) {
+		return s.recoverDuplicate(ctx, a, err)
+	}
+	if err != nil {
+		return account, err
+	}
+	if err = s.checkEnums(*account); err != nil {
+		return nil, err
+	}
+	return account, nil
+}
+
+// prepareIDs - fills in a missing ID (unless turned off) and the default
+// organisation, then makes sure both are well formed uuids since the
+// account api only rejects them with an opaque "id is not a valid uuid"
+func (s *Service) prepareIDs(a models.Account) (models.Account, error) {
 	if len(a.ID) <= 0 {
-		return nil, errors.New("ID field is missing, generate new UUID")
+		if !s.generateIDs {
+			return a, errors.New("ID field is missing, generate new UUID")
+		}
+		a.ID = uuid.New().String()
 	}
-	createAccountPath := fmt.Sprintf("%s/organisation/accounts", apiVersion)
-	err := s.http.Post(createAccountPath, a, account)
-	return account, err
+	if len(a.OrganisationID) <= 0 {
+		a.OrganisationID = s.organisationID
+	}
+
+	if !isUUID(a.ID) {
+		return a, fmt.Errorf("ID %q is not a valid uuid", a.ID)
+	}
+	if len(a.OrganisationID) > 0 && !isUUID(a.OrganisationID) {
+		return a, fmt.Errorf("OrganisationID %q is not a valid uuid", a.OrganisationID)
+	}
+	return a, nil
+}
+
+// checkEnums - with WithStrictEnums, the first unknown value in accounts
+func (s *Service) checkEnums(accounts ...models.Account) error {
+	if !s.strictEnums {
+		return nil
+	}
+	for _, a := range accounts {
+		if err := a.Attributes.Validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// isUUID - only the canonical 8-4-4-4-12 form is accepted, uuid.Parse on
+// its own also lets through urn: and braced forms the account api refuses
+func isUUID(id string) bool {
+	_, err := uuid.Parse(id)
+	return err == nil && len(id) == 36
 }
 
 // DeleteByID - get new account by ID
 func (s *Service) DeleteByID(id string) error {
+	return s.DeleteContext(s.http.Context, id, 0)
+}
+
+// DeleteContext - delete version of the account with ID id, bound to ctx.
+// The account api refuses the delete when the account is at another version
+func (s *Service) DeleteContext(ctx context.Context, id string, version int32) (err error) {
+	ctx, span := s.startSpan(ctx, "delete", id)
+	defer func() { endSpan(span, err) }()
+
 	if len(id) <= 0 {
 		return errors.New("Invalid id argument")
 	}
-	getAccountPath := fmt.Sprintf("%s/organisation/accounts/%s?version=0", apiVersion, id)
-	err := s.http.Delete(getAccountPath)
+	getAccountPath := fmt.Sprintf("%s/organisation/accounts/%s?version=%d", apiVersion, id, version)
+	err = s.http.DeleteContext(ctx, getAccountPath)
 	return err
 }
 
 // List - list paged accounts
-func (s *Service) List(pageNumber, pageItems int) ([]models.Account, error) {
+func (s *Service) List(pageNumber, pageItems int) (_ []models.Account, err error) {
+	ctx, span := s.startSpan(s.http.Context, "list", "")
+	defer func() { endSpan(span, err) }()
+
 	if pageNumber <= 0 || pageItems <= 0 {
 		return nil, errors.New("pageNumber and pageItem arguments must both be greater than 1")
 	}
@@ -73,12 +211,59 @@ func (s *Service) List(pageNumber, pageItems int) ([]models.Account, error) {
 
 	accounts := &[]models.Account{}
 	createAccountPath := fmt.Sprintf("%s/organisation/accounts", apiVersion)
-	err := s.http.Get(createAccountPath, accounts)
+	err = s.http.GetContext(ctx, createAccountPath, accounts)
 	if err != nil {
 		return nil, err
 	}
 	pagedAccounts := pageAccounts(start, stop, *accounts)
-	return pagedAccounts, err
+	if err = s.checkEnums(pagedAccounts...); err != nil {
+		return nil, err
+	}
+	return pagedAccounts, nil
+}
+
+// Walk - calls fn with every account, in the order the account api lists
+// them, stopping at the first error fn returns
+func (s *Service) Walk(pageSize int, fn func(models.Account) error) error {
+	return s.WalkContext(s.http.Context, pageSize, fn)
+}
+
+// WalkContext - Walk bound to ctx. Accounts are asked for pageSize at a time
+// so only a page is held in memory. When the account api ignores the paging
+// parameters it sends every account at once, that's detected and walked as
+// the only page
+func (s *Service) WalkContext(ctx context.Context, pageSize int, fn func(models.Account) error) (err error) {
+	ctx, span := s.startSpan(ctx, "list", "")
+	defer func() { endSpan(span, err) }()
+
+	if pageSize <= 0 {
+		return errors.New("pageSize argument must be greater than 0")
+	}
+	firstID := ""
+	for page := 0; ; page++ {
+		accounts := []models.Account{}
+		path := fmt.Sprintf("%s/organisation/accounts?page[number]=%d&page[size]=%d", apiVersion, page, pageSize)
+		if err = s.http.GetContext(ctx, path, &accounts); err != nil {
+			return err
+		}
+		if len(accounts) == 0 || page > 0 && accounts[0].ID == firstID {
+			return nil
+		}
+		if page == 0 {
+			firstID = accounts[0].ID
+		}
+		if err = s.checkEnums(accounts...); err != nil {
+			return err
+		}
+		for _, a := range accounts {
+			if err = fn(a); err != nil {
+				return err
+			}
+		}
+		if len(accounts) != pageSize {
+			return nil
+		}
+	}
 }
 
 // pageAccounts - paging here because the paging functionality of the downstream acount api isnt working
@@ -1,17 +1,34 @@
 package account
 
 import (
+	"account/fakeapi"
+	"account/iban"
 	"account/infrastructure"
+	"account/infrastructure/middleware"
+	"account/metrics"
 	"account/models"
+	"account/modulus"
+	"account/tracing"
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io/ioutil"
+	"math"
 	"net"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"reflect"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
+
+	"github.com/google/uuid"
 )
 
 var (
@@ -93,13 +110,13 @@ func TestCreateNoIDInAccountToCreate(t *testing.T) {
 
 	accountToCreate := models.Account{
 		Attributes:     attr,
-		CreatedOn:      "2020-08-25T21:24:39.999Z",
-		ModifiedOn:     "2020-08-25T21:24:39.999Z",
-		OrganisationID: "bcd",
+		CreatedOn:      createdOn,
+		ModifiedOn:     createdOn,
+		OrganisationID: createdOrganisationID,
 		Type:           "accounts",
 		Version:        0,
 	}
-	service = NewService(nil)
+	service = NewService(nil, WithoutIDGeneration())
 	_, err := service.Create(accountToCreate)
 	expectedErrorMessage := "ID field is missing, generate new UUID"
 	if !strings.Contains(err.Error(), expectedErrorMessage) {
@@ -107,6 +124,79 @@ func TestCreateNoIDInAccountToCreate(t *testing.T) {
 	}
 }
 
+func TestBuilderWithoutIDBuildsButCreateRefusesIt(t *testing.T) {
+	t.Parallel()
+	accountToCreate, err := NewGB().
+		OrganisationID(createdOrganisationID).
+		Classification(models.ClassificationPersonal).
+		BankID("400302").
+		AccountNumber("10000004").
+		Bic("NWBKGB42").
+		CustomerID("234").
+		IBAN("GB28NWBK40030212764204").
+		Build()
+	if err != nil {
+		t.Fatalf("Build of an account without an ID failed with error: %v", err)
+	}
+	_, err = NewService(nil, WithoutIDGeneration()).Create(accountToCreate)
+	if err == nil || !strings.Contains(err.Error(), "ID field is missing") {
+		t.Errorf("Create of a built account without an ID returned %v, expected the missing ID error", err)
+	}
+}
+
+func TestCreateGeneratesIDAndDefaultsOrganisation(t *testing.T) {
+	t.Parallel()
+	sent := make(chan models.Account, 1)
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body := &struct {
+			Data models.Account `json:"data"`
+		}{}
+		json.NewDecoder(r.Body).Decode(body)
+		sent <- body.Data
+		w.Write([]byte(OkCreateResponse))
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	httpClient, teardown := testingHTTPClient(h)
+	defer teardown()
+
+	hp := infrastructure.NewHTTP(ctx, httpClient, nil, userAgent)
+	service := NewService(hp, WithOrganisationID(createdOrganisationID))
+
+	if _, err := service.Create(models.Account{Type: "accounts"}); err != nil {
+		t.Fatalf("Create failed with error: %v", err)
+	}
+	a := <-sent
+	id, err := uuid.Parse(a.ID)
+	if err != nil || id.Version() != 4 {
+		t.Errorf("Create sent ID %q, expected a v4 uuid", a.ID)
+	}
+	if a.OrganisationID != createdOrganisationID {
+		t.Errorf("Create sent OrganisationID %q, expected the default %q", a.OrganisationID, createdOrganisationID)
+	}
+}
+
+func TestCreateInvalidUUIDs(t *testing.T) {
+	t.Parallel()
+	service := NewService(nil)
+	tests := []struct {
+		account models.Account
+		message string
+	}{
+		{models.Account{ID: "da968913"}, `ID "da968913" is not a valid uuid`},
+		{models.Account{ID: "{" + createdID + "}"}, "is not a valid uuid"},
+		{models.Account{ID: createdID, OrganisationID: "bcd"}, `OrganisationID "bcd" is not a valid uuid`},
+	}
+
+	for _, tt := range tests {
+		_, err := service.Create(tt.account)
+		if err == nil || !strings.Contains(err.Error(), tt.message) {
+			t.Errorf("Create(%+v) returned %v, expected %s", tt.account, err, tt.message)
+		}
+	}
+}
+
 func TestDeleteByIDInvalidArgument(t *testing.T) {
 	t.Parallel()
 	service = NewService(nil)
@@ -271,9 +361,9 @@ func TestGetByIDSuccess(t *testing.T) {
 
 	want := &models.Account{
 		Attributes:     attr,
-		CreatedOn:      "2020-08-25T21:24:39.999Z",
+		CreatedOn:      createdOn,
 		ID:             "abc",
-		ModifiedOn:     "2020-08-25T21:24:39.999Z",
+		ModifiedOn:     createdOn,
 		OrganisationID: "abc",
 		Type:           "accounts",
 		Version:        0,
@@ -332,10 +422,10 @@ func TestCreateSuccess(t *testing.T) {
 
 	accountToCreate := models.Account{
 		Attributes:     attr,
-		CreatedOn:      "2020-08-25T21:24:39.999Z",
-		ID:             "bcd",
-		ModifiedOn:     "2020-08-25T21:24:39.999Z",
-		OrganisationID: "bcd",
+		CreatedOn:      createdOn,
+		ID:             createdID,
+		ModifiedOn:     createdOn,
+		OrganisationID: createdOrganisationID,
 		Type:           "accounts",
 		Version:        0,
 	}
@@ -347,10 +437,10 @@ func TestCreateSuccess(t *testing.T) {
 
 	want := &models.Account{
 		Attributes:     attr,
-		CreatedOn:      "2020-08-25T21:24:39.999Z",
-		ID:             "bcd",
-		ModifiedOn:     "2020-08-25T21:24:39.999Z",
-		OrganisationID: "bcd",
+		CreatedOn:      createdOn,
+		ID:             createdID,
+		ModifiedOn:     createdOn,
+		OrganisationID: createdOrganisationID,
 		Type:           "accounts",
 		Version:        0,
 	}
@@ -387,10 +477,10 @@ func TestCreateFailure(t *testing.T) {
 
 	accountToCreate := models.Account{
 		Attributes:     attr,
-		CreatedOn:      "2020-08-25T21:24:39.999Z",
-		ID:             "bcd",
-		ModifiedOn:     "2020-08-25T21:24:39.999Z",
-		OrganisationID: "bcd",
+		CreatedOn:      createdOn,
+		ID:             createdID,
+		ModifiedOn:     createdOn,
+		OrganisationID: createdOrganisationID,
 		Type:           "accounts",
 		Version:        0,
 	}
@@ -437,6 +527,940 @@ func TestDeleteFailure(t *testing.T) {
 	}
 }
 
+func TestGetByIDRevalidatesWithETag(t *testing.T) {
+	t.Parallel()
+	etag := `"abc-0"`
+	requests := 0
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.Header.Get("If-None-Match") == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", etag)
+		w.Write([]byte(OkGetResponse))
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	httpClient, teardown := testingHTTPClient(h)
+	defer teardown()
+
+	hp := infrastructure.NewHTTP(ctx, httpClient, nil, userAgent)
+	hp.Cache = infrastructure.NewCache()
+	service = NewService(hp)
+
+	first, err := service.GetByID("abc")
+	if err != nil {
+		t.Fatalf("GetByID failed with error: %v", err)
+	}
+	second, err := service.GetByID("abc")
+	if err != nil {
+		t.Fatalf("GetByID revalidation failed with error: %v", err)
+	}
+
+	if requests != 2 {
+		t.Errorf("GetByID made %d requests, expected 2", requests)
+	}
+	if !reflect.DeepEqual(first, second) {
+		t.Errorf("GetByID returned %+v from cache instead of %+v", second, first)
+	}
+
+	if err := service.DeleteByID("abc"); err != nil {
+		t.Fatalf("DeleteByID failed with error: %v", err)
+	}
+	if hp.Cache.Len() != 0 {
+		t.Errorf("DeleteByID left %d cached resources, expected none", hp.Cache.Len())
+	}
+}
+
+func TestGetByIDCoalescesConcurrentCalls(t *testing.T) {
+	t.Parallel()
+	var requests int32
+	release := make(chan struct{})
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		<-release
+		w.Write([]byte(OkGetResponse))
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	httpClient, teardown := testingHTTPClient(h)
+	defer teardown()
+
+	hp := infrastructure.NewHTTP(ctx, httpClient, nil, userAgent)
+	service := NewService(hp)
+
+	// this caller gives up early, the others must still get their account
+	impatientCtx, impatientCancel := context.WithCancel(ctx)
+	impatientErr := make(chan error, 1)
+	go func() {
+		_, err := service.GetByIDContext(impatientCtx, "abc")
+		impatientErr <- err
+	}()
+	for atomic.LoadInt32(&requests) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	callers := 5
+	results := make(chan *models.Account, callers)
+	errs := make(chan error, callers)
+	for i := 0; i < callers; i++ {
+		go func() {
+			a, err := service.GetByIDContext(ctx, "abc")
+			results <- a
+			errs <- err
+		}()
+	}
+
+	time.Sleep(50 * time.Millisecond)
+	impatientCancel()
+	if err := <-impatientErr; err != context.Canceled {
+		t.Errorf("cancelled caller returned %v, expected %v", err, context.Canceled)
+	}
+	close(release)
+
+	seen := map[*models.Account]bool{}
+	for i := 0; i < callers; i++ {
+		if err := <-errs; err != nil {
+			t.Fatalf("GetByIDContext failed with error: %v", err)
+		}
+		a := <-results
+		if a.ID != "abc" {
+			t.Errorf("GetByIDContext returned %s, expected abc", a.ID)
+		}
+		if seen[a] {
+			t.Error("GetByIDContext handed the same account to two callers")
+		}
+		seen[a] = true
+	}
+
+	if n := atomic.LoadInt32(&requests); n != 1 {
+		t.Errorf("GetByIDContext made %d requests, expected 1", n)
+	}
+}
+
+func TestMiddlewareChain(t *testing.T) {
+	t.Parallel()
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token" || r.Header.Get("X-Order") != "second" {
+			w.Write([]byte(NonExistentAccountResponse))
+			return
+		}
+		w.Write([]byte(OkGetResponse))
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	httpClient, teardown := testingHTTPClient(h)
+	defer teardown()
+
+	var logged []string
+	hp := infrastructure.NewHTTP(ctx, httpClient, nil, userAgent)
+	hp.Middleware = []infrastructure.Middleware{
+		middleware.Logging(func(format string, args ...interface{}) {
+			logged = append(logged, fmt.Sprintf(format, args...))
+		}),
+		middleware.BearerToken("token"),
+		middleware.Header("X-Order", "first"),
+		middleware.Header("X-Order", "second"),
+	}
+	service = NewService(hp)
+
+	if _, err := service.GetByID("abc"); err != nil {
+		t.Fatalf("GetByID failed with error: %v", err)
+	}
+	if len(logged) != 1 || !strings.Contains(logged[0], "GET") {
+		t.Errorf("Logging middleware wrote %v, expected a single GET line", logged)
+	}
+
+	faulty := errors.New("injected")
+	hp.Middleware = []infrastructure.Middleware{
+		middleware.Fault(func(r *http.Request) bool { return r.Method == http.MethodDelete }, faulty),
+	}
+	if err := service.DeleteByID("abc"); !errors.Is(err, faulty) {
+		t.Errorf("DeleteByID returned %v, expected the injected fault", err)
+	}
+}
+
+type recordingLogger struct {
+	mu    sync.Mutex
+	lines []string
+}
+
+func (l *recordingLogger) log(level, msg string, args ...interface{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.lines = append(l.lines, fmt.Sprint(level, " ", msg, " ", args))
+}
+
+func (l *recordingLogger) Debug(msg string, args ...interface{}) { l.log("DEBUG", msg, args...) }
+func (l *recordingLogger) Info(msg string, args ...interface{})  { l.log("INFO", msg, args...) }
+func (l *recordingLogger) Error(msg string, args ...interface{}) { l.log("ERROR", msg, args...) }
+
+func TestLoggingRedactsSensitiveFields(t *testing.T) {
+	t.Parallel()
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(OkCreateResponse))
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	httpClient, teardown := testingHTTPClient(h)
+	defer teardown()
+
+	logger := &recordingLogger{}
+	hp := infrastructure.NewHTTP(ctx, httpClient, nil, userAgent)
+	hp.Logger = logger
+	service = NewService(hp)
+
+	attr := models.Attributes{
+		AccountNumber: "10000004",
+		BankID:        "400302",
+		Bic:           "NWBKGB42",
+		Country:       "GB",
+		CustomerID:    "234",
+		IBAN:          "GB28NWBK40030212764204",
+	}
+	accountToCreate := models.Account{Attributes: attr, ID: createdID, OrganisationID: createdOrganisationID}
+	if _, err := service.Create(accountToCreate); err != nil {
+		t.Fatalf("Create failed with error: %v", err)
+	}
+
+	all := strings.Join(logger.lines, "\n")
+	if !strings.Contains(all, "INFO account api request [method POST") || !strings.Contains(all, "status 200") {
+		t.Errorf("request was not logged with its method and status, got: %s", all)
+	}
+	if !strings.Contains(all, "DEBUG account api request body") || !strings.Contains(all, "400302") {
+		t.Errorf("bodies were not logged at debug, got: %s", all)
+	}
+	for _, sensitive := range []string{"10000004", "NWBKGB42", "GB28NWBK40030212764204", `"234"`} {
+		if strings.Contains(all, sensitive) {
+			t.Errorf("log leaked %s: %s", sensitive, all)
+		}
+	}
+
+	redacted := accountToCreate.Redacted()
+	if redacted.Attributes.IBAN != models.Redacted || redacted.Attributes.BankID != attr.BankID {
+		t.Errorf("Redacted returned %+v", redacted.Attributes)
+	}
+}
+
+func TestMetricsRecordedPerOperation(t *testing.T) {
+	t.Parallel()
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodDelete {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(NonExistentAccountResponse))
+			return
+		}
+		w.Write([]byte(OkGetResponse))
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	httpClient, teardown := testingHTTPClient(h)
+	defer teardown()
+
+	registry := metrics.NewRegistry()
+	hp := infrastructure.NewHTTP(ctx, httpClient, nil, userAgent)
+	hp.Metrics = registry
+	service = NewService(hp)
+
+	if _, err := service.GetByID("abc"); err != nil {
+		t.Fatalf("GetByID failed with error: %v", err)
+	}
+	err := service.DeleteByID("abc")
+	var apiErr *infrastructure.APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusNotFound {
+		t.Fatalf("DeleteByID returned %v, expected a 404 APIError", err)
+	}
+
+	snapshot := registry.Snapshot()
+	if snapshot.Requests["get"][http.StatusOK] != 1 {
+		t.Errorf("get requests recorded %v, expected one 200", snapshot.Requests["get"])
+	}
+	if snapshot.Errors["delete"][metrics.ClassClient] != 1 {
+		t.Errorf("delete errors recorded %v, expected one client error", snapshot.Errors["delete"])
+	}
+	if snapshot.InFlight["get"] != 0 || snapshot.Latency["get"].Count != 1 {
+		t.Errorf("get in flight %d latency %+v, expected 0 in flight and one observation", snapshot.InFlight["get"], snapshot.Latency["get"])
+	}
+
+	var text strings.Builder
+	if err := registry.WriteText(&text); err != nil {
+		t.Fatalf("WriteText failed with error: %v", err)
+	}
+	for _, line := range []string{
+		`account_api_requests_total{operation="get",status="200"} 1`,
+		`account_api_errors_total{operation="delete",class="client"} 1`,
+		`account_api_request_duration_seconds_count{operation="delete"} 1`,
+		`account_api_requests_in_flight{operation="get"} 0`,
+	} {
+		if !strings.Contains(text.String(), line) {
+			t.Errorf("prometheus output is missing %s:\n%s", line, text.String())
+		}
+	}
+}
+
+func TestTracingSpansAndPropagation(t *testing.T) {
+	t.Parallel()
+	traceParents := make(chan string, 1)
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceParents <- r.Header.Get("traceparent")
+		w.Write([]byte(OkGetResponse))
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	httpClient, teardown := testingHTTPClient(h)
+	defer teardown()
+
+	recorder := tracing.NewRecorder()
+	hp := infrastructure.NewHTTP(ctx, httpClient, nil, userAgent)
+	service := NewService(hp, WithTracer(recorder))
+
+	remote, err := tracing.ParseTraceParent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", "")
+	if err != nil {
+		t.Fatalf("ParseTraceParent failed with error: %v", err)
+	}
+	if _, err := service.GetByIDContext(tracing.ContextWithSpanContext(ctx, remote), "abc"); err != nil {
+		t.Fatalf("GetByIDContext failed with error: %v", err)
+	}
+
+	spans := recorder.Spans()
+	if len(spans) != 1 {
+		t.Fatalf("recorded %d spans, expected 1", len(spans))
+	}
+	span := spans[0]
+	if span.Name != "account.get" || span.Attribute("account.id") != "abc" || span.Attribute("http.status_code") != http.StatusOK {
+		t.Errorf("span recorded as %s %v", span.Name, span.Attributes)
+	}
+	if span.Parent != remote || span.Context.TraceID != remote.TraceID {
+		t.Errorf("span did not continue the caller's trace, parent %v", span.Parent)
+	}
+	if got := <-traceParents; got != span.Context.TraceParent() {
+		t.Errorf("request carried traceparent %s, expected %s", got, span.Context.TraceParent())
+	}
+
+	if err := service.DeleteByID(""); err == nil || recorder.Spans()[1].Err == nil {
+		t.Error("DeleteByID span did not record the error")
+	}
+}
+
+func TestRateLimiterSharedAcrossServices(t *testing.T) {
+	t.Parallel()
+	var requests int32
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&requests, 1) == 3 {
+			w.WriteHeader(http.StatusTooManyRequests)
+			w.Write([]byte(`{"error_message":"too many requests"}`))
+			return
+		}
+		w.Write([]byte(OkGetResponse))
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	httpClient, teardown := testingHTTPClient(h)
+	defer teardown()
+
+	limiter := infrastructure.NewRateLimiter(20, 1)
+	first := infrastructure.NewHTTP(ctx, httpClient, nil, userAgent)
+	first.Limiter = limiter
+	second := infrastructure.NewHTTP(ctx, httpClient, nil, userAgent)
+	second.Limiter = limiter
+
+	start := time.Now()
+	NewService(first).GetByID("abc")
+	NewService(second).GetByID("abc")
+	NewService(first).GetByID("abc")
+	if elapsed := time.Since(start); elapsed < 90*time.Millisecond {
+		t.Errorf("3 requests at 20/s with a burst of 1 took %v, expected at least 100ms", elapsed)
+	}
+	if limiter.Rate() != 10 {
+		t.Errorf("rate after a 429 is %v, expected it halved to 10", limiter.Rate())
+	}
+
+	cancelled, cancelNow := context.WithCancel(ctx)
+	cancelNow()
+	if err := limiter.Wait(cancelled); err != context.Canceled {
+		t.Errorf("Wait on a cancelled context returned %v, expected %v", err, context.Canceled)
+	}
+}
+
+func TestRateLimiterRejectsRatesNotAboveZero(t *testing.T) {
+	for _, rate := range []float64{0, -1, math.NaN()} {
+		func() {
+			defer func() {
+				if r := recover(); r == nil || !strings.Contains(fmt.Sprint(r), "greater than 0") {
+					t.Errorf("NewRateLimiter(%v) panicked with %v, expected a rate error", rate, r)
+				}
+			}()
+			infrastructure.NewRateLimiter(rate, 1)
+		}()
+	}
+}
+
+func TestCircuitBreakerOpensAndRecovers(t *testing.T) {
+	t.Parallel()
+	var requests, healthy int32
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		if atomic.LoadInt32(&healthy) == 0 {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte(`{"error_message":"internal error"}`))
+			return
+		}
+		w.Write([]byte(OkGetResponse))
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	httpClient, teardown := testingHTTPClient(h)
+	defer teardown()
+
+	var mu sync.Mutex
+	var transitions []string
+	hp := infrastructure.NewHTTP(ctx, httpClient, nil, userAgent)
+	hp.Breaker = infrastructure.NewCircuitBreaker(infrastructure.BreakerSettings{
+		FailureThreshold: 2,
+		CoolDown:         50 * time.Millisecond,
+		OnStateChange: func(from, to infrastructure.BreakerState) {
+			mu.Lock()
+			defer mu.Unlock()
+			transitions = append(transitions, from.String()+"->"+to.String())
+		},
+	})
+	service = NewService(hp)
+
+	service.GetByID("abc")
+	service.GetByID("abc")
+	if _, err := service.GetByID("abc"); err != infrastructure.ErrCircuitOpen {
+		t.Fatalf("GetByID returned %v with the circuit open, expected %v", err, infrastructure.ErrCircuitOpen)
+	}
+	if n := atomic.LoadInt32(&requests); n != 2 {
+		t.Errorf("%d requests reached the account api, expected the open circuit to stop the third", n)
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	atomic.StoreInt32(&healthy, 1)
+	if _, err := service.GetByID("abc"); err != nil {
+		t.Fatalf("GetByID failed after the cool down with error: %v", err)
+	}
+	if state := hp.Breaker.State(); state != infrastructure.StateClosed {
+		t.Errorf("circuit is %v after a successful trial, expected closed", state)
+	}
+
+	want := []string{"closed->open", "open->half-open", "half-open->closed"}
+	mu.Lock()
+	defer mu.Unlock()
+	if !reflect.DeepEqual(transitions, want) {
+		t.Errorf("state changes were %v, expected %v", transitions, want)
+	}
+}
+
+func TestCircuitBreakerIgnoresSuccessAllowedBeforeItOpened(t *testing.T) {
+	t.Parallel()
+	arrived, finish := make(chan struct{}), make(chan struct{})
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/slow") {
+			close(arrived)
+			<-finish
+			w.Write([]byte(OkGetResponse))
+			return
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(`{"error_message":"internal error"}`))
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	httpClient, teardown := testingHTTPClient(h)
+	defer teardown()
+
+	hp := infrastructure.NewHTTP(ctx, httpClient, nil, userAgent)
+	hp.Breaker = infrastructure.NewCircuitBreaker(infrastructure.BreakerSettings{
+		FailureThreshold: 2,
+		CoolDown:         time.Minute,
+	})
+	service := NewService(hp)
+
+	slow := make(chan error, 1)
+	go func() {
+		_, err := service.GetByID("slow")
+		slow <- err
+	}()
+	<-arrived
+	service.GetByID("abc")
+	service.GetByID("abc")
+	if state := hp.Breaker.State(); state != infrastructure.StateOpen {
+		t.Fatalf("circuit is %v after 2 failures, expected open", state)
+	}
+
+	close(finish)
+	if err := <-slow; err != nil {
+		t.Fatalf("GetByID allowed before the circuit opened failed with error: %v", err)
+	}
+	if state := hp.Breaker.State(); state != infrastructure.StateOpen {
+		t.Errorf("circuit is %v after a success allowed before it opened, expected it to stay open", state)
+	}
+}
+
+func TestCreateRetriesAndRecoversDuplicate(t *testing.T) {
+	t.Parallel()
+	var mu sync.Mutex
+	var keys []string
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			w.Write([]byte(OkCreateResponse))
+			return
+		}
+		mu.Lock()
+		keys = append(keys, r.Header.Get("Idempotency-Key"))
+		attempt := len(keys)
+		mu.Unlock()
+		if attempt == 1 {
+			// the account gets created but the response never makes it back
+			w.WriteHeader(http.StatusServiceUnavailable)
+			w.Write([]byte(`{"error_message":"service unavailable"}`))
+			return
+		}
+		w.WriteHeader(http.StatusConflict)
+		w.Write([]byte(BadCreateResponse))
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	httpClient, teardown := testingHTTPClient(h)
+	defer teardown()
+
+	hp := infrastructure.NewHTTP(ctx, httpClient, nil, userAgent)
+	service := NewService(hp, WithRetries(3, time.Millisecond), WithDuplicateRecovery())
+	attr := models.Attributes{
+		AccountClassification: "Personal",
+		AccountNumber:         "10000004",
+		BankID:                "400302",
+		BankIDCode:            "GBDSC",
+		BaseCurrency:          "GBP",
+		Bic:                   "NWBKGB42",
+		Country:               "GB",
+		CustomerID:            "234",
+		IBAN:                  "GB28NWBK40030212764204",
+	}
+
+	accountReceived, err := service.Create(models.Account{Attributes: attr, ID: createdID, OrganisationID: createdOrganisationID})
+	if err != nil {
+		t.Fatalf("Create failed with error: %v", err)
+	}
+	if accountReceived.ID != createdID {
+		t.Errorf("Create returned %+v, expected the existing account", accountReceived)
+	}
+	mu.Lock()
+	if len(keys) != 2 || len(keys[0]) == 0 || keys[0] != keys[1] {
+		t.Errorf("Create sent idempotency keys %v, expected the same key on both attempts", keys)
+	}
+	mu.Unlock()
+
+	attr.CustomerID = "999"
+	_, err = service.Create(models.Account{Attributes: attr, ID: createdID, OrganisationID: createdOrganisationID})
+	var apiErr *infrastructure.APIError
+	if !errors.As(err, &apiErr) || !strings.Contains(err.Error(), "different attributes") {
+		t.Errorf("Create of a different account returned %v, expected the duplicate error", err)
+	}
+}
+
+func TestCreateRetryStopsWhenContextEnds(t *testing.T) {
+	t.Parallel()
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		w.Write([]byte(`{"error_message":"service unavailable"}`))
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	httpClient, teardown := testingHTTPClient(h)
+	defer teardown()
+
+	service := NewService(infrastructure.NewHTTP(ctx, httpClient, nil, userAgent), WithRetries(3, time.Minute))
+	a, err := NewGB().ID(createdID).OrganisationID(createdOrganisationID).
+		BankID("400302").AccountNumber("10000004").Bic("NWBKGB42").Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	impatient, stop := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer stop()
+	_, err = service.CreateContext(impatient, a)
+	if !errors.Is(err, context.DeadlineExceeded) || !strings.Contains(err.Error(), "service unavailable") {
+		t.Errorf("Create returned %v, expected the deadline wrapped with the last attempt's error", err)
+	}
+}
+
+func TestStrictEnumsRejectUnknownValues(t *testing.T) {
+	t.Parallel()
+	var calls int32
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.Write([]byte(strings.Replace(OkGetResponse, `"account_classification": "Personal"`, `"account_classification": "personal"`, 1)))
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	httpClient, teardown := testingHTTPClient(h)
+	defer teardown()
+
+	hp := infrastructure.NewHTTP(ctx, httpClient, nil, userAgent)
+	strict := NewService(hp, WithStrictEnums())
+	attr := models.Attributes{
+		AccountClassification: models.ClassificationPersonal,
+		BankIDCode:            models.BankIDCodeGBDSC,
+		BaseCurrency:          models.CurrencyGBP,
+		Country:               "UK",
+	}
+
+	_, err := strict.Create(models.Account{Attributes: attr, ID: createdID})
+	var unknown *models.UnknownValueError
+	if !errors.As(err, &unknown) || unknown.Kind != "country" || unknown.Value != "UK" {
+		t.Errorf("Create with country UK returned %v, expected an unknown country error", err)
+	}
+	if atomic.LoadInt32(&calls) != 0 {
+		t.Error("Create sent an account with an unknown country to the account api")
+	}
+
+	_, err = strict.GetByID(createdID)
+	if !errors.As(err, &unknown) || unknown.Kind != "classification" {
+		t.Errorf("GetByID of an account with classification personal returned %v, expected an unknown classification error", err)
+	}
+
+	a, err := NewService(hp).GetByID(createdID)
+	if err != nil || a.Attributes.AccountClassification != "personal" {
+		t.Errorf("GetByID without strict enums returned %v and %+v, expected the classification as is", err, a)
+	}
+}
+
+func TestCreateOmitsTimestampsAndDecodesThem(t *testing.T) {
+	t.Parallel()
+	sent := make(chan map[string]json.RawMessage, 1)
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body := &struct {
+			Data map[string]json.RawMessage `json:"data"`
+		}{}
+		json.NewDecoder(r.Body).Decode(body)
+		sent <- body.Data
+		w.Write([]byte(OkCreateResponse))
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	httpClient, teardown := testingHTTPClient(h)
+	defer teardown()
+
+	service := NewService(infrastructure.NewHTTP(ctx, httpClient, nil, userAgent))
+	accountReceived, err := service.Create(models.Account{ID: createdID, CreatedOn: createdOn, ModifiedOn: createdOn})
+	if err != nil {
+		t.Fatalf("Create failed with error: %v", err)
+	}
+
+	data := <-sent
+	if _, ok := data["created_on"]; ok {
+		t.Errorf("Create sent created_on %s, expected it to be left out", data["created_on"])
+	}
+	if _, ok := data["modified_on"]; ok {
+		t.Errorf("Create sent modified_on %s, expected it to be left out", data["modified_on"])
+	}
+
+	want := time.Date(2020, 8, 25, 21, 24, 39, 999000000, time.UTC)
+	if !accountReceived.CreatedOn.Equal(want) || accountReceived.ModifiedOn.Before(accountReceived.CreatedOn.Time) {
+		t.Errorf("Create returned created_on %v and modified_on %v, expected %v", accountReceived.CreatedOn, accountReceived.ModifiedOn, want)
+	}
+	b, _ := json.Marshal(accountReceived)
+	if !strings.Contains(string(b), `"created_on":"2020-08-25T21:24:39.999Z"`) {
+		t.Errorf("re-encoded account %s, expected created_on in the format it arrived in", b)
+	}
+}
+
+func TestBuilderFillsCountryTemplateAndValidates(t *testing.T) {
+	t.Parallel()
+	a, err := NewGB().
+		ID(createdID).
+		OrganisationID(createdOrganisationID).
+		Classification(models.ClassificationPersonal).
+		BankID("400302").
+		AccountNumber("10000004").
+		Bic("NWBKGB42").
+		Build()
+	if err != nil {
+		t.Fatalf("Build failed with error: %v", err)
+	}
+	want := models.Attributes{
+		AccountClassification: models.ClassificationPersonal,
+		AccountNumber:         "10000004",
+		BankID:                "400302",
+		BankIDCode:            models.BankIDCodeGBDSC,
+		BaseCurrency:          models.CurrencyGBP,
+		Bic:                   "NWBKGB42",
+		Country:               models.CountryGB,
+	}
+	if a.Type != "accounts" || !reflect.DeepEqual(a.Attributes, want) {
+		t.Errorf("Build returned %+v, expected type accounts and %+v", a, want)
+	}
+
+	_, err = NewGB().BankID("4003").AccountNumber("123").Build()
+	var validationErr *ValidationError
+	if !errors.As(err, &validationErr) || len(validationErr.Problems) != 3 {
+		t.Fatalf("Build of a bad GB account returned %v, expected bank id, bic and account number problems", err)
+	}
+
+	if _, err = NewNL().BankID("400302").Bic("ABNANL2A").Build(); err == nil {
+		t.Error("Build of an NL account with a bank id succeeded, expected an error")
+	}
+	if _, err = NewBuilder("UK").Build(); err == nil {
+		t.Error("Build of a UK account succeeded, expected an unsupported country error")
+	}
+
+	// the templates agree with the bban layouts of package iban
+	for _, s := range []string{
+		"BE68539007547034",
+		"CH9300762011623852957",
+		"DE89370400440532013000",
+		"ES9121000418450200051332",
+		"FR1420041010050500013M02606",
+		"GB29NWBK60161331926819",
+		"GR1601101250000000012300695",
+		"IT60X0542811101000000123456",
+		"LU280019400644750000",
+		"NL91ABNA0417164300",
+		"PL61109010140000071219812874",
+		"PT50000201231234567890154",
+	} {
+		attr, err := iban.Parse(s)
+		if err != nil {
+			t.Fatalf("Parse(%s) failed with error: %v", s, err)
+		}
+		attr.Bic = s[4:8] + string(attr.Country) + "XX"
+		if err = Validate(models.Account{Attributes: attr}); err != nil {
+			t.Errorf("Validate of the account parsed from %s returned %v", s, err)
+		}
+	}
+}
+
+func TestModulusCheckerValidatesCreates(t *testing.T) {
+	t.Parallel()
+	checker, err := modulus.Load(strings.NewReader("107000 107999 MOD11    0    0    0    0    0    0    8    7    6    5    4    3    2    1\n"))
+	if err != nil {
+		t.Fatalf("Load failed with error: %v", err)
+	}
+
+	var calls int32
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.Write([]byte(OkCreateResponse))
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	httpClient, teardown := testingHTTPClient(h)
+	defer teardown()
+
+	service := NewService(infrastructure.NewHTTP(ctx, httpClient, nil, userAgent), WithValidator(checker))
+	a, _ := NewGB().ID(createdID).BankID("107999").AccountNumber("88837492").Bic("NWBKGB42").Build()
+	if _, err = service.Create(a); !errors.Is(err, modulus.ErrInvalid) {
+		t.Errorf("Create with a bad account number returned %v, expected %v", err, modulus.ErrInvalid)
+	}
+	if atomic.LoadInt32(&calls) != 0 {
+		t.Error("Create sent an account that failed the modulus check to the account api")
+	}
+}
+
+func TestWalkWhenPagingIsIgnored(t *testing.T) {
+	t.Parallel()
+	var calls int32
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.Write([]byte(OkListResponse))
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	httpClient, teardown := testingHTTPClient(h)
+	defer teardown()
+
+	service := NewService(infrastructure.NewHTTP(ctx, httpClient, nil, userAgent))
+	for _, size := range []int{2, 3} {
+		var ids []string
+		err := service.Walk(size, func(a models.Account) error {
+			ids = append(ids, a.ID)
+			return nil
+		})
+		if err != nil || len(ids) != 3 {
+			t.Errorf("Walk with page size %d returned %v and walked %v, expected each account once", size, err, ids)
+		}
+	}
+	if n := atomic.LoadInt32(&calls); n != 3 {
+		t.Errorf("Walk made %d requests, expected 3", n)
+	}
+}
+
+func TestWatchEmitsChangesAndResumesFromCursor(t *testing.T) {
+	t.Parallel()
+	var mu sync.Mutex
+	accounts := []models.Account{{ID: "1", Version: 0}, {ID: "2", Version: 0}, {ID: "3", Version: 0}}
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		json.NewEncoder(w).Encode(map[string]interface{}{"data": accounts})
+	})
+	httpClient, teardown := testingHTTPClient(h)
+	defer teardown()
+	service := NewService(infrastructure.NewHTTP(context.Background(), httpClient, nil, userAgent))
+
+	dir, _ := ioutil.TempDir("", "watch")
+	defer os.RemoveAll(dir)
+	cursor := FileCursor(filepath.Join(dir, "cursor.json"))
+
+	next := func(events <-chan Event) (Event, bool) {
+		select {
+		case e, ok := <-events:
+			return e, ok
+		case <-time.After(time.Second):
+			return Event{}, false
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	events, err := service.Watch(ctx, 5*time.Millisecond, WatchOptions{Cursor: cursor})
+	if err != nil {
+		t.Fatalf("Watch failed with error: %v", err)
+	}
+	for _, id := range []string{"1", "2", "3"} {
+		if e, _ := next(events); e.Type != AccountCreated || e.Account.ID != id {
+			t.Errorf("Watch sent %+v, expected account %s created", e, id)
+		}
+	}
+
+	mu.Lock()
+	accounts = []models.Account{{ID: "1", Version: 1}, {ID: "3", Version: 0}}
+	mu.Unlock()
+	if e, _ := next(events); e.Type != AccountModified || e.Account.ID != "1" {
+		t.Errorf("Watch sent %+v, expected account 1 modified", e)
+	}
+	if e, _ := next(events); e.Type != AccountDeleted || e.Account.ID != "2" {
+		t.Errorf("Watch sent %+v, expected account 2 deleted", e)
+	}
+	cancel()
+	for range events {
+	}
+
+	// a restart carries on from the cursor rather than replaying every account
+	mu.Lock()
+	accounts = append(accounts, models.Account{ID: "4"})
+	mu.Unlock()
+	ctx, cancel = context.WithCancel(context.Background())
+	defer cancel()
+	events, _ = service.Watch(ctx, 5*time.Millisecond, WatchOptions{Cursor: cursor})
+	if e, _ := next(events); e.Type != AccountCreated || e.Account.ID != "4" {
+		t.Errorf("restarted Watch sent %+v, expected only account 4 created", e)
+	}
+}
+
+func TestWatchResendsAFailedPollAndSortsDeletes(t *testing.T) {
+	t.Parallel()
+	var mu sync.Mutex
+	accounts := []models.Account{{ID: "1"}, {ID: "2"}, {ID: "3"}, {ID: "4"}}
+	failed := false
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		number, _ := strconv.Atoi(r.URL.Query().Get("page[number]"))
+		size, _ := strconv.Atoi(r.URL.Query().Get("page[size]"))
+		if number == 1 && accounts[0].Version == 1 && !failed {
+			failed = true
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte(`{"error_message":"internal error"}`))
+			return
+		}
+		page := []models.Account{}
+		if start := number * size; start < len(accounts) {
+			page = accounts[start:]
+			if len(page) > size {
+				page = page[:size]
+			}
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"data": page})
+	})
+	httpClient, teardown := testingHTTPClient(h)
+	defer teardown()
+	service := NewService(infrastructure.NewHTTP(context.Background(), httpClient, nil, userAgent))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if _, err := service.Watch(ctx, 0, WatchOptions{}); err == nil {
+		t.Error("Watch with an interval of 0 succeeded, expected an error")
+	}
+	events, err := service.Watch(ctx, 5*time.Millisecond, WatchOptions{PageSize: 2, OnError: func(error) {}})
+	if err != nil {
+		t.Fatalf("Watch failed with error: %v", err)
+	}
+	expect := func(typ EventType, ids ...string) {
+		t.Helper()
+		for _, id := range ids {
+			select {
+			case e := <-events:
+				if e.Type != typ || e.Account.ID != id {
+					t.Errorf("Watch sent %s %s, expected %s %s", e.Type, e.Account.ID, typ, id)
+				}
+			case <-time.After(time.Second):
+				t.Fatalf("Watch sent nothing, expected %s %s", typ, id)
+			}
+		}
+	}
+	expect(AccountCreated, "1", "2", "3", "4")
+
+	// the second page fails once, the next poll sends the first page's event again
+	mu.Lock()
+	accounts = []models.Account{{ID: "1", Version: 1}, {ID: "2"}, {ID: "3"}, {ID: "4", Version: 1}}
+	mu.Unlock()
+	expect(AccountModified, "1", "1", "4")
+
+	mu.Lock()
+	accounts = []models.Account{{ID: "1", Version: 1}}
+	mu.Unlock()
+	expect(AccountDeleted, "2", "3", "4")
+}
+
+func TestCreateRetriesThroughFailuresInjectedByTheFakeAPI(t *testing.T) {
+	t.Parallel()
+	server := fakeapi.NewServer(fakeapi.NewStore())
+	server.SetFaults(fakeapi.Faults{Seed: 3, Routes: map[string]fakeapi.Fault{fakeapi.RouteCreate: {ServerError: 0.5}}})
+	httpClient, teardown := testingHTTPClient(server)
+	defer teardown()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	a, err := NewGB().OrganisationID(createdOrganisationID).BankID("400302").AccountNumber("10000004").Bic("NWBKGB42").Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	without := NewService(infrastructure.NewHTTP(ctx, httpClient, nil, userAgent))
+	with := NewService(infrastructure.NewHTTP(ctx, httpClient, nil, userAgent), WithRetries(5, time.Millisecond))
+	failed := 0
+	for i := 0; i < 10; i++ {
+		a.ID = uuid.New().String()
+		if _, err := without.Create(a); err != nil {
+			failed++
+		}
+		a.ID = uuid.New().String()
+		if _, err := with.Create(a); err != nil {
+			t.Errorf("Create with retries through server errors failed with error: %v", err)
+		}
+	}
+	if failed == 0 {
+		t.Error("no Create without retries failed, expected the injected server errors to show")
+	}
+}
+
 func testingHTTPClient(handler http.Handler) (*http.Client, func()) {
 	s := httptest.NewServer(handler)
 
@@ -1,6 +1,14 @@
 package account
 
+import "account/models"
+
 const (
+	// createdID - id of the account in OkCreateResponse
+	createdID = "ad27e265-9605-4b4b-a0e5-3003ea9cc4dc"
+
+	// createdOrganisationID - organisation of the account in OkCreateResponse
+	createdOrganisationID = "eb0bd6f5-c3f5-44b2-b677-acd23cdde73c"
+
 	// OkGetResponse - mock ok get response
 	OkGetResponse = `{
 		"data": {
@@ -44,14 +52,14 @@ const (
 			"iban": "GB28NWBK40030212764204"
 		  },
 		  "created_on": "2020-08-25T21:24:39.999Z",
-		  "id": "bcd",
+		  "id": "ad27e265-9605-4b4b-a0e5-3003ea9cc4dc",
 		  "modified_on": "2020-08-25T21:24:39.999Z",
-		  "organisation_id": "bcd",
+		  "organisation_id": "eb0bd6f5-c3f5-44b2-b677-acd23cdde73c",
 		  "type": "accounts",
 		  "version": 0
 		},
 		"links": {
-		  "self": "/v1/organisation/accounts/bcd"
+		  "self": "/v1/organisation/accounts/ad27e265-9605-4b4b-a0e5-3003ea9cc4dc"
 		}
 	  }`
 
@@ -138,3 +146,6 @@ const (
 	// BadListAccountResponse - mock listing error (if listing was to return some error response)
 	BadListAccountResponse = `{"error_message":"some downstream error"}`
 )
+
+// createdOn - created_on and modified_on of the account in OkCreateResponse
+var createdOn, _ = models.ParseTimestamp("2020-08-25T21:24:39.999Z")
@@ -0,0 +1,268 @@
+package account
+
+import (
+	"account/models"
+	"fmt"
+	"strings"
+)
+
+// accountType - the resource type the account api expects for accounts
+const accountType = "accounts"
+
+type (
+	// Builder - builds an account for one country, filling in the bank id
+	// code, base currency and type and checking the fields the country
+	// needs are there
+	Builder struct {
+		account models.Account
+	}
+
+	// ValidationError - the fields of a built account that the account api
+	// would refuse
+	ValidationError struct {
+		Country  models.Country
+		Problems []string
+	}
+
+	// template - what a country needs, lengths of 0 mean any length
+	template struct {
+		bankIDCode          models.BankIDCode
+		currency            models.Currency
+		bankIDRequired      bool
+		bankIDNotAllowed    bool
+		bankIDLengths       []int
+		bicRequired         bool
+		accountNumberLength [2]int
+	}
+)
+
+// templates - the rules for each country the account api supports
+var templates = map[models.Country]template{
+	models.CountryAU: {bankIDCode: models.BankIDCodeAUBSB, currency: models.CurrencyAUD, bankIDLengths: []int{6}, bicRequired: true, accountNumberLength: [2]int{6, 10}},
+	models.CountryBE: {bankIDCode: models.BankIDCodeBE, currency: models.CurrencyEUR, bankIDRequired: true, bankIDLengths: []int{3}, accountNumberLength: [2]int{7, 7}},
+	models.CountryCA: {bankIDCode: models.BankIDCodeCACPA, currency: models.CurrencyCAD, bankIDLengths: []int{9}, bicRequired: true, accountNumberLength: [2]int{7, 12}},
+	models.CountryCH: {bankIDCode: models.BankIDCodeCHBCC, currency: models.CurrencyCHF, bankIDRequired: true, bankIDLengths: []int{5}, accountNumberLength: [2]int{12, 12}},
+	models.CountryDE: {bankIDCode: models.BankIDCodeDEBLZ, currency: models.CurrencyEUR, bankIDRequired: true, bankIDLengths: []int{8}, accountNumberLength: [2]int{1, 10}},
+	models.CountryES: {bankIDCode: models.BankIDCodeESNCC, currency: models.CurrencyEUR, bankIDRequired: true, bankIDLengths: []int{8, 9}, accountNumberLength: [2]int{10, 10}},
+	models.CountryFR: {bankIDCode: models.BankIDCodeFR, currency: models.CurrencyEUR, bankIDRequired: true, bankIDLengths: []int{10}, accountNumberLength: [2]int{11, 11}},
+	models.CountryGB: {bankIDCode: models.BankIDCodeGBDSC, currency: models.CurrencyGBP, bankIDRequired: true, bankIDLengths: []int{6}, bicRequired: true, accountNumberLength: [2]int{8, 8}},
+	models.CountryGR: {bankIDCode: models.BankIDCodeGRBIC, currency: models.CurrencyEUR, bankIDRequired: true, bankIDLengths: []int{7}, accountNumberLength: [2]int{16, 16}},
+	models.CountryHK: {bankIDCode: models.BankIDCodeHKNCC, currency: models.CurrencyHKD, bankIDLengths: []int{3}, bicRequired: true, accountNumberLength: [2]int{9, 12}},
+	models.CountryIT: {bankIDCode: models.BankIDCodeITNCC, currency: models.CurrencyEUR, bankIDRequired: true, bankIDLengths: []int{10, 11}, accountNumberLength: [2]int{12, 12}},
+	models.CountryLU: {bankIDCode: models.BankIDCodeLULUX, currency: models.CurrencyEUR, bankIDRequired: true, bankIDLengths: []int{3}, accountNumberLength: [2]int{13, 13}},
+	models.CountryNL: {currency: models.CurrencyEUR, bankIDNotAllowed: true, bicRequired: true, accountNumberLength: [2]int{10, 10}},
+	models.CountryPL: {bankIDCode: models.BankIDCodePLKNR, currency: models.CurrencyPLN, bankIDRequired: true, bankIDLengths: []int{8}, accountNumberLength: [2]int{16, 16}},
+	models.CountryPT: {bankIDCode: models.BankIDCodePTNCC, currency: models.CurrencyEUR, bankIDRequired: true, bankIDLengths: []int{8}, accountNumberLength: [2]int{11, 11}},
+	models.CountryUS: {bankIDCode: models.BankIDCodeUSABA, currency: models.CurrencyUSD, bankIDRequired: true, bankIDLengths: []int{9}, bicRequired: true, accountNumberLength: [2]int{6, 17}},
+}
+
+// NewBuilder - a builder for an account in country, Build fails for
+// countries the account api doesn't support
+func NewBuilder(country models.Country) *Builder {
+	t := templates[country]
+	return &Builder{
+		account: models.Account{
+			Type: accountType,
+			Attributes: models.Attributes{
+				BankIDCode:   t.bankIDCode,
+				BaseCurrency: t.currency,
+				Country:      country,
+			},
+		},
+	}
+}
+
+// NewAU - a builder for an Australian account
+func NewAU() *Builder { return NewBuilder(models.CountryAU) }
+
+// NewBE - a builder for a Belgian account
+func NewBE() *Builder { return NewBuilder(models.CountryBE) }
+
+// NewCA - a builder for a Canadian account
+func NewCA() *Builder { return NewBuilder(models.CountryCA) }
+
+// NewCH - a builder for a Swiss account
+func NewCH() *Builder { return NewBuilder(models.CountryCH) }
+
+// NewDE - a builder for a German account
+func NewDE() *Builder { return NewBuilder(models.CountryDE) }
+
+// NewES - a builder for a Spanish account
+func NewES() *Builder { return NewBuilder(models.CountryES) }
+
+// NewFR - a builder for a French account
+func NewFR() *Builder { return NewBuilder(models.CountryFR) }
+
+// NewGB - a builder for a UK account
+func NewGB() *Builder { return NewBuilder(models.CountryGB) }
+
+// NewGR - a builder for a Greek account
+func NewGR() *Builder { return NewBuilder(models.CountryGR) }
+
+// NewHK - a builder for a Hong Kong account
+func NewHK() *Builder { return NewBuilder(models.CountryHK) }
+
+// NewIT - a builder for an Italian account
+func NewIT() *Builder { return NewBuilder(models.CountryIT) }
+
+// NewLU - a builder for a Luxembourg account
+func NewLU() *Builder { return NewBuilder(models.CountryLU) }
+
+// NewNL - a builder for a Dutch account
+func NewNL() *Builder { return NewBuilder(models.CountryNL) }
+
+// NewPL - a builder for a Polish account
+func NewPL() *Builder { return NewBuilder(models.CountryPL) }
+
+// NewPT - a builder for a Portuguese account
+func NewPT() *Builder { return NewBuilder(models.CountryPT) }
+
+// NewUS - a builder for a US account
+func NewUS() *Builder { return NewBuilder(models.CountryUS) }
+
+// ID - the account id, Create generates one when it's left out
+func (b *Builder) ID(id string) *Builder {
+	b.account.ID = id
+	return b
+}
+
+// OrganisationID - the organisation the account belongs to
+func (b *Builder) OrganisationID(id string) *Builder {
+	b.account.OrganisationID = id
+	return b
+}
+
+// Classification - personal or business
+func (b *Builder) Classification(c models.Classification) *Builder {
+	b.account.Attributes.AccountClassification = c
+	return b
+}
+
+// BankID - the bank id in the country's bank id code scheme, e.g. the sort
+// code for GB
+func (b *Builder) BankID(id string) *Builder {
+	b.account.Attributes.BankID = id
+	return b
+}
+
+// AccountNumber - the account number, left out for the account api to
+// generate one
+func (b *Builder) AccountNumber(n string) *Builder {
+	b.account.Attributes.AccountNumber = n
+	return b
+}
+
+// Bic - the SWIFT BIC of the bank
+func (b *Builder) Bic(bic string) *Builder {
+	b.account.Attributes.Bic = bic
+	return b
+}
+
+// IBAN - the IBAN, left out for the account api to generate one
+func (b *Builder) IBAN(iban string) *Builder {
+	b.account.Attributes.IBAN = iban
+	return b
+}
+
+// BaseCurrency - overrides the country's currency
+func (b *Builder) BaseCurrency(c models.Currency) *Builder {
+	b.account.Attributes.BaseCurrency = c
+	return b
+}
+
+// CustomerID - the customer the account belongs to
+func (b *Builder) CustomerID(id string) *Builder {
+	b.account.Attributes.CustomerID = id
+	return b
+}
+
+// AlternativeBankAccountNames - other names the account is known by
+func (b *Builder) AlternativeBankAccountNames(names string) *Builder {
+	b.account.Attributes.AlternativeBankAccountNames = names
+	return b
+}
+
+// Build - the account, or a *ValidationError listing everything the account
+// api would refuse
+func (b *Builder) Build() (models.Account, error) {
+	a := b.account
+	return a, Validate(a)
+}
+
+// Validate - checks a has what its country needs, the same checks Build
+// makes. Returns a *ValidationError listing everything the account api
+// would refuse
+func Validate(a models.Account) error {
+	var problems []string
+	problem := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	country := a.Attributes.Country
+	t, ok := templates[country]
+	if !ok {
+		problem("country %q isn't supported", country)
+	}
+	if err := a.Attributes.Validate(); err != nil {
+		problem("%v", err)
+	}
+	if len(a.ID) > 0 && !isUUID(a.ID) {
+		problem("ID %q is not a valid uuid", a.ID)
+	}
+	if len(a.OrganisationID) > 0 && !isUUID(a.OrganisationID) {
+		problem("OrganisationID %q is not a valid uuid", a.OrganisationID)
+	}
+
+	bankID := a.Attributes.BankID
+	switch {
+	case t.bankIDNotAllowed && len(bankID) > 0:
+		problem("bank id isn't used in %s", country)
+	case t.bankIDRequired && len(bankID) == 0:
+		problem("bank id is required in %s", country)
+	case len(bankID) > 0 && !oneOf(len(bankID), t.bankIDLengths):
+		problem("bank id %q should be %s characters", bankID, joinLengths(t.bankIDLengths))
+	}
+	if t.bicRequired && len(a.Attributes.Bic) == 0 {
+		problem("bic is required in %s", country)
+	}
+	if n := len(a.Attributes.AccountNumber); n > 0 && t.accountNumberLength[0] > 0 &&
+		(n < t.accountNumberLength[0] || n > t.accountNumberLength[1]) {
+		problem("account number %q should be %s characters", a.Attributes.AccountNumber, rangeOf(t.accountNumberLength))
+	}
+
+	if len(problems) > 0 {
+		return &ValidationError{Country: country, Problems: problems}
+	}
+	return nil
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("invalid %s account: %s", e.Country, strings.Join(e.Problems, ", "))
+}
+
+func oneOf(n int, lengths []int) bool {
+	if len(lengths) == 0 {
+		return true
+	}
+	for _, l := range lengths {
+		if n == l {
+			return true
+		}
+	}
+	return false
+}
+
+func joinLengths(lengths []int) string {
+	s := make([]string, len(lengths))
+	for i, l := range lengths {
+		s[i] = fmt.Sprint(l)
+	}
+	return strings.Join(s, " or ")
+}
+
+func rangeOf(r [2]int) string {
+	if r[0] == r[1] {
+		return fmt.Sprint(r[0])
+	}
+	return fmt.Sprintf("%d to %d", r[0], r[1])
+}
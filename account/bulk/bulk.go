@@ -0,0 +1,371 @@
+// Package bulk - imports accounts from CSV and JSON Lines files and exports
+// them back out. Columns (CSV) and keys (JSON Lines) are mapped to account
+// fields with a Mapping, rows are read and written one at a time so files of
+// any size can be handled
+package bulk
+
+import (
+	"account"
+	"account/models"
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Formats
+const (
+	CSV   Format = "csv"
+	JSONL Format = "jsonl"
+)
+
+// maxLine - the longest JSON Lines record read
+const maxLine = 1 << 20
+
+type (
+	// Format - the file format, csv or jsonl
+	Format string
+
+	// Record - an account read from line Line of the file
+	Record struct {
+		Line    int
+		Account models.Account
+	}
+
+	// RowError - the row on line Line couldn't be read, was invalid or
+	// couldn't be created
+	RowError struct {
+		Line int
+		ID   string
+		Err  error
+	}
+
+	// Reader - reads accounts from a file a row at a time
+	Reader struct {
+		// Validate - checks each row, defaults to account.Validate
+		Validate func(models.Account) error
+
+		format  Format
+		mapping Mapping
+		csv     *csv.Reader
+		buf     *bufio.Reader
+		counter *lineCounter
+		lines   *bufio.Scanner
+		columns []string
+		line    int
+	}
+
+	// Writer - writes accounts to a file a row at a time, call Flush when
+	// done
+	Writer struct {
+		format  Format
+		mapping Mapping
+		csv     *csv.Writer
+		w       *bufio.Writer
+		started bool
+	}
+
+	// Report - the outcome of an Import
+	Report struct {
+		Read    int
+		Created int
+		Errors  []*RowError
+	}
+
+	// lineCounter - counts the lines read through it
+	lineCounter struct {
+		r     io.Reader
+		lines int
+	}
+)
+
+// ParseFormat - the format named s
+func ParseFormat(s string) (Format, error) {
+	switch f := Format(strings.ToLower(s)); f {
+	case CSV, JSONL:
+		return f, nil
+	}
+	return "", fmt.Errorf("unknown format %q, expected csv or jsonl", s)
+}
+
+// NewReader - reads accounts in format from r. A nil mapping is
+// DefaultMapping, columns that aren't mapped are ignored
+func NewReader(r io.Reader, format Format, mapping Mapping) (*Reader, error) {
+	if mapping == nil {
+		mapping = DefaultMapping()
+	}
+	if err := mapping.validate(); err != nil {
+		return nil, err
+	}
+
+	rd := &Reader{Validate: account.Validate, format: format, mapping: mapping}
+	switch format {
+	case CSV:
+		// csv.Reader reads through buf rather than its own buffer, so the
+		// lines it has used are those counted less those still in buf
+		rd.counter = &lineCounter{r: r}
+		rd.buf = bufio.NewReader(rd.counter)
+		rd.csv = csv.NewReader(rd.buf)
+		rd.csv.FieldsPerRecord = -1
+		rd.csv.ReuseRecord = true
+	case JSONL:
+		rd.lines = bufio.NewScanner(r)
+		rd.lines.Buffer(make([]byte, 64*1024), maxLine)
+	default:
+		return nil, fmt.Errorf("unknown format %q", format)
+	}
+	return rd, nil
+}
+
+// Next - the next account. Rows that can't be read or fail Validate return
+// a *RowError, carry on calling Next to skip them. io.EOF at the end
+func (r *Reader) Next() (Record, error) {
+	if r.format == CSV {
+		return r.nextCSV()
+	}
+	return r.nextJSONL()
+}
+
+func (r *Reader) nextCSV() (Record, error) {
+	if r.columns == nil {
+		header, err := r.csv.Read()
+		if err != nil {
+			return Record{}, err
+		}
+		r.columns = make([]string, len(header))
+		for i, h := range header {
+			r.columns[i], _ = r.mapping.field(strings.TrimSpace(h))
+		}
+	}
+
+	// a quoted value can span lines, so the line a row starts on is the
+	// one after those read so far and the blank lines csv.Reader skips
+	r.skipBlankLines()
+	r.line = r.linesRead() + 1
+	row, err := r.csv.Read()
+	var parseErr *csv.ParseError
+	if errors.As(err, &parseErr) {
+		return Record{}, &RowError{Line: r.line, Err: parseErr.Err}
+	}
+	if err != nil {
+		return Record{}, err
+	}
+
+	a := models.Account{}
+	for i, v := range row {
+		if i >= len(r.columns) || len(r.columns[i]) == 0 {
+			continue
+		}
+		if err := fields[r.columns[i]].set(&a, strings.TrimSpace(v)); err != nil {
+			return Record{}, &RowError{Line: r.line, Err: err}
+		}
+	}
+	return r.validate(a)
+}
+
+// linesRead - the lines csv.Reader has read
+func (r *Reader) linesRead() int {
+	buffered, _ := r.buf.Peek(r.buf.Buffered())
+	return r.counter.lines - bytes.Count(buffered, []byte{'\n'})
+}
+
+func (r *Reader) skipBlankLines() {
+	for {
+		if b, _ := r.buf.Peek(1); bytes.Equal(b, []byte("\n")) {
+			r.buf.Discard(1)
+		} else if b, _ := r.buf.Peek(2); bytes.Equal(b, []byte("\r\n")) {
+			r.buf.Discard(2)
+		} else {
+			return
+		}
+	}
+}
+
+func (c *lineCounter) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.lines += bytes.Count(p[:n], []byte{'\n'})
+	return n, err
+}
+
+func (r *Reader) nextJSONL() (Record, error) {
+	for r.lines.Scan() {
+		r.line++
+		if len(strings.TrimSpace(r.lines.Text())) == 0 {
+			continue
+		}
+
+		dec := json.NewDecoder(strings.NewReader(r.lines.Text()))
+		dec.UseNumber()
+		values := map[string]interface{}{}
+		if err := dec.Decode(&values); err != nil {
+			return Record{}, &RowError{Line: r.line, Err: err}
+		}
+		a := models.Account{}
+		for key, v := range values {
+			name, ok := r.mapping.field(key)
+			if !ok {
+				continue
+			}
+			if err := fields[name].set(&a, jsonText(v)); err != nil {
+				return Record{}, &RowError{Line: r.line, Err: err}
+			}
+		}
+		return r.validate(a)
+	}
+	if err := r.lines.Err(); err != nil {
+		return Record{}, err
+	}
+	return Record{}, io.EOF
+}
+
+func (r *Reader) validate(a models.Account) (Record, error) {
+	if r.Validate != nil {
+		if err := r.Validate(a); err != nil {
+			return Record{}, &RowError{Line: r.line, ID: a.ID, Err: err}
+		}
+	}
+	return Record{Line: r.line, Account: a}, nil
+}
+
+// NewWriter - writes accounts in format to w. A nil mapping is
+// DefaultMapping
+func NewWriter(w io.Writer, format Format, mapping Mapping) (*Writer, error) {
+	if mapping == nil {
+		mapping = DefaultMapping()
+	}
+	if err := mapping.validate(); err != nil {
+		return nil, err
+	}
+
+	wr := &Writer{format: format, mapping: mapping}
+	switch format {
+	case CSV:
+		wr.csv = csv.NewWriter(w)
+	case JSONL:
+		wr.w = bufio.NewWriter(w)
+	default:
+		return nil, fmt.Errorf("unknown format %q", format)
+	}
+	return wr, nil
+}
+
+// Write - writes a as the next row, the CSV header goes before the first
+func (w *Writer) Write(a models.Account) error {
+	if w.format == CSV {
+		if !w.started {
+			w.started = true
+			if err := w.csv.Write(w.mapping.Headers()); err != nil {
+				return err
+			}
+		}
+		row := make([]string, len(w.mapping))
+		for i, c := range w.mapping {
+			row[i] = fields[c.Field].get(&a)
+		}
+		return w.csv.Write(row)
+	}
+
+	w.w.WriteByte('{')
+	for i, c := range w.mapping {
+		if i > 0 {
+			w.w.WriteByte(',')
+		}
+		key, _ := json.Marshal(c.Header)
+		w.w.Write(key)
+		w.w.WriteByte(':')
+		v := fields[c.Field].get(&a)
+		if c.Field == "version" {
+			w.w.WriteString(v)
+			continue
+		}
+		value, _ := json.Marshal(v)
+		w.w.Write(value)
+	}
+	_, err := w.w.WriteString("}\n")
+	return err
+}
+
+// Flush - writes anything buffered to the underlying writer
+func (w *Writer) Flush() error {
+	if w.format == CSV {
+		w.csv.Flush()
+		return w.csv.Error()
+	}
+	return w.w.Flush()
+}
+
+// Import - creates every valid account r reads through s. Rows that are
+// invalid or fail to create are reported rather than stopping the import,
+// the error is only for r failing or ctx being done
+func Import(ctx context.Context, s *account.Service, r *Reader) (*Report, error) {
+	report := &Report{}
+	for {
+		if err := ctx.Err(); err != nil {
+			return report, err
+		}
+		rec, err := r.Next()
+		if err == io.EOF {
+			return report, nil
+		}
+		var rowErr *RowError
+		if errors.As(err, &rowErr) {
+			report.Read++
+			report.Errors = append(report.Errors, rowErr)
+			continue
+		}
+		if err != nil {
+			return report, err
+		}
+
+		report.Read++
+		if _, err := s.CreateContext(ctx, rec.Account); err != nil {
+			report.Errors = append(report.Errors, &RowError{Line: rec.Line, ID: rec.Account.ID, Err: err})
+			continue
+		}
+		report.Created++
+	}
+}
+
+// Export - writes every account to w, a page of pageSize at a time, and
+// flushes it. Returns how many were written
+func Export(ctx context.Context, s *account.Service, w *Writer, pageSize int) (int, error) {
+	n := 0
+	err := s.WalkContext(ctx, pageSize, func(a models.Account) error {
+		n++
+		return w.Write(a)
+	})
+	if err != nil {
+		return n, err
+	}
+	return n, w.Flush()
+}
+
+func (e *RowError) Error() string {
+	if len(e.ID) > 0 {
+		return fmt.Sprintf("line %d (%s): %v", e.Line, e.ID, e.Err)
+	}
+	return fmt.Sprintf("line %d: %v", e.Line, e.Err)
+}
+
+func (e *RowError) Unwrap() error {
+	return e.Err
+}
+
+// jsonText - a JSON Lines value as the text a CSV column would hold
+func jsonText(v interface{}) string {
+	switch t := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return t
+	case json.Number:
+		return t.String()
+	}
+	b, _ := json.Marshal(v)
+	return string(b)
+}
@@ -0,0 +1,305 @@
+package bulk
+
+import (
+	"account"
+	"account/infrastructure"
+	"account/models"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestBulkImportAndExport(t *testing.T) {
+	var mu sync.Mutex
+	var created []models.Account
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if r.Method == http.MethodPost {
+			body := &struct {
+				Data models.Account `json:"data"`
+			}{}
+			json.NewDecoder(r.Body).Decode(body)
+			created = append(created, body.Data)
+			json.NewEncoder(w).Encode(body)
+			return
+		}
+		// pages of two, as the account api sends them
+		var page, size int
+		fmt.Sscan(r.URL.Query().Get("page[number]"), &page)
+		fmt.Sscan(r.URL.Query().Get("page[size]"), &size)
+		start, stop := page*size, page*size+size
+		if stop > len(created) {
+			stop = len(created)
+		}
+		if start > stop {
+			start = stop
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"data": created[start:stop]})
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	s := httptest.NewServer(h)
+	defer s.Close()
+
+	u, _ := url.Parse(s.URL)
+	service := account.NewService(infrastructure.NewHTTP(ctx, s.Client(), u, ""))
+	in := "Account ID,Sort Code,Account No,Country,BIC,Notes\n" +
+		"ad27e265-9605-4b4b-a0e5-3003ea9cc4dc,400302,10000004,GB,NWBKGB42,first\n" +
+		"ad27e265-9605-4b4b-a0e5-3003ea9cc4dd,4003,10000005,GB,NWBKGB42,bad sort code\n" +
+		"ad27e265-9605-4b4b-a0e5-3003ea9cc4de,400302,10000006,GB,NWBKGB42,\n" +
+		"ad27e265-9605-4b4b-a0e5-3003ea9cc4df,400302,10000007,GB,NWBKGB42,\n"
+	mapping, err := ParseMapping("Account ID=id,Sort Code=bank_id,Account No=account_number,Country=country,BIC=bic")
+	if err != nil {
+		t.Fatalf("ParseMapping failed with error: %v", err)
+	}
+	r, _ := NewReader(strings.NewReader(in), CSV, mapping)
+	report, err := Import(ctx, service, r)
+	if err != nil {
+		t.Fatalf("Import failed with error: %v", err)
+	}
+	if report.Read != 4 || report.Created != 3 || len(report.Errors) != 1 || report.Errors[0].Line != 3 {
+		t.Fatalf("Import reported %+v, expected 3 created and line 3 failing", report)
+	}
+
+	var out strings.Builder
+	w, _ := NewWriter(&out, JSONL, Mapping{{Header: "id", Field: "id"}, {Header: "account", Field: "account_number"}})
+	n, err := Export(ctx, service, w, 2)
+	want := `{"id":"ad27e265-9605-4b4b-a0e5-3003ea9cc4dc","account":"10000004"}
+{"id":"ad27e265-9605-4b4b-a0e5-3003ea9cc4de","account":"10000006"}
+{"id":"ad27e265-9605-4b4b-a0e5-3003ea9cc4df","account":"10000007"}
+`
+	if err != nil || n != 3 || out.String() != want {
+		t.Errorf("Export returned %d, %v and wrote %q, expected %q", n, err, out.String(), want)
+	}
+}
+
+func TestReaderNumbersRowsAfterValuesSpanningLines(t *testing.T) {
+	in := "Account ID,Sort Code,Account No,Country,BIC,Notes\n" +
+		"ad27e265-9605-4b4b-a0e5-3003ea9cc4dc,400302,10000004,GB,NWBKGB42,\"first\nsecond\nthird\"\n" +
+		"\n" +
+		"ad27e265-9605-4b4b-a0e5-3003ea9cc4dd,4003,10000005,GB,NWBKGB42,bad sort code\n" +
+		"ad27e265-9605-4b4b-a0e5-3003ea9cc4de,400302,10000006,GB,NWBKGB42,\"bad \"quote\n" +
+		"ad27e265-9605-4b4b-a0e5-3003ea9cc4df,400302,10000007,GB,NWBKGB42,\r\n"
+	mapping, _ := ParseMapping("Account ID=id,Sort Code=bank_id,Account No=account_number,Country=country,BIC=bic")
+	r, _ := NewReader(strings.NewReader(in), CSV, mapping)
+
+	var lines []int
+	for {
+		rec, err := r.Next()
+		if err == io.EOF {
+			break
+		}
+		if rowErr, ok := err.(*RowError); ok {
+			lines = append(lines, -rowErr.Line)
+			continue
+		}
+		if err != nil {
+			t.Fatalf("Next failed with error: %v", err)
+		}
+		lines = append(lines, rec.Line)
+	}
+	// failing rows are negated
+	if want := []int{2, -6, -7, 8}; !reflect.DeepEqual(lines, want) {
+		t.Errorf("Next read rows on lines %v, expected %v", lines, want)
+	}
+}
+
+// accountAPI - creates and fetches accounts, calling created after every
+// account it creates
+type accountAPI struct {
+	mu       sync.Mutex
+	accounts map[string]models.Account
+	gets     int
+	posts    int
+	created  func(posts int)
+}
+
+func (api *accountAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	api.mu.Lock()
+	defer api.mu.Unlock()
+	if r.Method == http.MethodGet {
+		api.gets++
+		a, ok := api.accounts[path.Base(r.URL.Path)]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"error_message":"record does not exist"}`))
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]models.Account{"data": a})
+		return
+	}
+
+	body := &struct {
+		Data models.Account `json:"data"`
+	}{}
+	json.NewDecoder(r.Body).Decode(body)
+	api.posts++
+	if _, ok := api.accounts[body.Data.ID]; ok {
+		w.WriteHeader(http.StatusConflict)
+		w.Write([]byte(`{"error_message":"Account cannot be created as it violates a duplicate constraint"}`))
+		return
+	}
+	api.accounts[body.Data.ID] = body.Data
+	if api.created != nil {
+		api.created(api.posts)
+	}
+	json.NewEncoder(w).Encode(body)
+}
+
+func TestRunnerResumesFromCheckpoint(t *testing.T) {
+	var cancelFirstRun context.CancelFunc
+	api := &accountAPI{accounts: map[string]models.Account{}, created: func(posts int) {
+		if posts == 3 {
+			// the pod restarts after the account is created but before
+			// the response gets back
+			cancelFirstRun()
+		}
+	}}
+	s := httptest.NewServer(api)
+	defer s.Close()
+	u, _ := url.Parse(s.URL)
+
+	in := "id,bank_id,account_number,country,bic\n"
+	for i := 0; i < 5; i++ {
+		in += fmt.Sprintf("ad27e265-9605-4b4b-a0e5-3003ea9cc4d%d,400302,1000000%d,GB,NWBKGB42\n", i, i)
+	}
+	dir, _ := ioutil.TempDir("", "checkpoint")
+	defer os.RemoveAll(dir)
+
+	run := func(ctx context.Context) (*Checkpoint, []Progress, error) {
+		var progress []Progress
+		service := account.NewService(infrastructure.NewHTTP(ctx, s.Client(), u, ""))
+		runner := &Runner{
+			Service:          service,
+			Checkpoint:       filepath.Join(dir, "import.json"),
+			BatchSize:        2,
+			Total:            5,
+			ProgressInterval: time.Nanosecond,
+			OnProgress:       func(p Progress) { progress = append(progress, p) },
+		}
+		rd, _ := NewReader(strings.NewReader(in), CSV, nil)
+		cp, err := runner.Run(ctx, rd)
+		return cp, progress, err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancelFirstRun = cancel
+	cp, _, err := run(ctx)
+	if err != context.Canceled || cp.Offset != 3 || len(cp.Created) != 2 {
+		t.Fatalf("first run returned %v with %+v, expected it cancelled after two rows", err, cp)
+	}
+
+	cp, progress, err := run(context.Background())
+	if err != nil || cp.Offset != 6 || len(cp.Created) != 5 || len(cp.Failures) != 0 {
+		t.Fatalf("second run returned %v with %+v, expected all five created", err, cp)
+	}
+	if api.posts != 6 {
+		t.Errorf("the runs created %d times, expected the two checkpointed rows to be skipped", api.posts)
+	}
+	last := progress[len(progress)-1]
+	if last.Processed != 5 || last.Created != 5 || last.ETA != 0 {
+		t.Errorf("last progress was %+v, expected 5 processed and created", last)
+	}
+
+	saved, err := LoadCheckpoint(filepath.Join(dir, "import.json"))
+	if err != nil || !reflect.DeepEqual(saved.Created, cp.Created) {
+		t.Errorf("LoadCheckpoint returned %+v, %v, expected the final checkpoint", saved, err)
+	}
+}
+
+func TestRunnerResumesRowsWithoutIDsWithoutDuplicates(t *testing.T) {
+	var cancelFirstRun context.CancelFunc
+	api := &accountAPI{accounts: map[string]models.Account{}, created: func(posts int) {
+		if posts == 3 {
+			cancelFirstRun()
+		}
+	}}
+	existing := models.Account{ID: "ad27e265-9605-4b4b-a0e5-3003ea9cc4d9", Attributes: models.Attributes{Country: models.CountryGB, BankID: "400399"}}
+	api.accounts[existing.ID] = existing
+	s := httptest.NewServer(api)
+	defer s.Close()
+	u, _ := url.Parse(s.URL)
+
+	in := "bank_id,account_number,country,bic\n"
+	for i := 0; i < 4; i++ {
+		in += fmt.Sprintf("400302,1000000%d,GB,NWBKGB42\n", i)
+	}
+	dir, _ := ioutil.TempDir("", "checkpoint")
+	defer os.RemoveAll(dir)
+
+	run := func(ctx context.Context, in string) (*Checkpoint, error) {
+		runner := &Runner{
+			Service:    account.NewService(infrastructure.NewHTTP(ctx, s.Client(), u, "")),
+			Checkpoint: filepath.Join(dir, "import.json"),
+			Source:     "accounts.csv",
+			BatchSize:  10,
+		}
+		rd, _ := NewReader(strings.NewReader(in), CSV, nil)
+		return runner.Run(ctx, rd)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancelFirstRun = cancel
+	if _, err := run(ctx, in); err != context.Canceled {
+		t.Fatalf("first run returned %v, expected it cancelled", err)
+	}
+	cp, err := run(context.Background(), in)
+	if err != nil || len(cp.Created) != 4 || len(cp.Failures) != 0 {
+		t.Fatalf("second run returned %v with %+v, expected all four created", err, cp)
+	}
+	if len(api.accounts) != 5 {
+		t.Errorf("the account api holds %d accounts, expected the four rows once each and the existing one", len(api.accounts))
+	}
+
+	// a duplicate that isn't the account the row describes fails the row
+	conflicting := "id,bank_id,account_number,country,bic\n" + existing.ID + ",400302,10000009,GB,NWBKGB42\n"
+	os.Remove(filepath.Join(dir, "import.json"))
+	cp, err = run(context.Background(), conflicting)
+	if err != nil || len(cp.Created) != 0 || len(cp.Failures) != 1 || !strings.Contains(cp.Failures[0].Error, "different attributes") {
+		t.Errorf("run of a conflicting row returned %v with %+v, expected it failed", err, cp)
+	}
+}
+
+func TestRunnerRecoversDuplicatesOnceWithDuplicateRecovery(t *testing.T) {
+	api := &accountAPI{accounts: map[string]models.Account{}}
+	for _, id := range []string{"ad27e265-9605-4b4b-a0e5-3003ea9cc4d8", "ad27e265-9605-4b4b-a0e5-3003ea9cc4d9"} {
+		api.accounts[id] = models.Account{ID: id, Attributes: models.Attributes{Country: models.CountryGB, BankID: "400302", AccountNumber: "10000001", Bic: "NWBKGB42"}}
+	}
+	s := httptest.NewServer(api)
+	defer s.Close()
+	u, _ := url.Parse(s.URL)
+	dir, _ := ioutil.TempDir("", "checkpoint")
+	defer os.RemoveAll(dir)
+
+	// the first row is the existing account, the second conflicts with one
+	in := "id,bank_id,account_number,country,bic\n" +
+		"ad27e265-9605-4b4b-a0e5-3003ea9cc4d8,400302,10000001,GB,NWBKGB42\n" +
+		"ad27e265-9605-4b4b-a0e5-3003ea9cc4d9,400302,10000002,GB,NWBKGB42\n"
+	runner := &Runner{
+		Service:    account.NewService(infrastructure.NewHTTP(context.Background(), s.Client(), u, ""), account.WithDuplicateRecovery()),
+		Checkpoint: filepath.Join(dir, "import.json"),
+	}
+	rd, _ := NewReader(strings.NewReader(in), CSV, nil)
+	cp, err := runner.Run(context.Background(), rd)
+	if err != nil || len(cp.Created) != 1 || len(cp.Failures) != 1 || !strings.Contains(cp.Failures[0].Error, "different attributes") {
+		t.Errorf("Run returned %v with %+v, expected the first row created and the second failed", err, cp)
+	}
+	if api.gets != 2 {
+		t.Errorf("Run fetched the existing accounts %d times, expected once each", api.gets)
+	}
+}
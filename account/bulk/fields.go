@@ -0,0 +1,155 @@
+package bulk
+
+import (
+	"account/models"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+type (
+	// Column - a CSV column or JSON Lines key and the account field, named
+	// as in the account api's json, it holds
+	Column struct {
+		Header string
+		Field  string
+	}
+
+	// Mapping - the columns of a file, in order
+	Mapping []Column
+
+	// field - reads and writes one field of an account as text
+	field struct {
+		get func(a *models.Account) string
+		set func(a *models.Account, v string) error
+	}
+)
+
+// fieldNames - every field, in the order DefaultMapping lists them
+var fieldNames = []string{
+	"id", "organisation_id", "type", "version", "created_on", "modified_on",
+	"account_classification", "account_number", "alternative_bank_account_names",
+	"bank_id", "bank_id_code", "base_currency", "bic", "country", "customer_id", "iban",
+}
+
+var fields = map[string]field{
+	"id":              text(func(a *models.Account) *string { return &a.ID }),
+	"organisation_id": text(func(a *models.Account) *string { return &a.OrganisationID }),
+	"type":            text(func(a *models.Account) *string { return &a.Type }),
+	"version": {
+		get: func(a *models.Account) string { return strconv.Itoa(int(a.Version)) },
+		set: func(a *models.Account, v string) error {
+			if len(v) == 0 {
+				a.Version = 0
+				return nil
+			}
+			n, err := strconv.ParseInt(v, 10, 32)
+			if err != nil {
+				return fmt.Errorf("version %q isn't a number", v)
+			}
+			a.Version = int32(n)
+			return nil
+		},
+	},
+	"created_on":                     timestamp(func(a *models.Account) *models.Timestamp { return &a.CreatedOn }),
+	"modified_on":                    timestamp(func(a *models.Account) *models.Timestamp { return &a.ModifiedOn }),
+	"account_classification":         text(func(a *models.Account) *string { return (*string)(&a.Attributes.AccountClassification) }),
+	"account_number":                 text(func(a *models.Account) *string { return &a.Attributes.AccountNumber }),
+	"alternative_bank_account_names": text(func(a *models.Account) *string { return &a.Attributes.AlternativeBankAccountNames }),
+	"bank_id":                        text(func(a *models.Account) *string { return &a.Attributes.BankID }),
+	"bank_id_code":                   text(func(a *models.Account) *string { return (*string)(&a.Attributes.BankIDCode) }),
+	"base_currency":                  text(func(a *models.Account) *string { return (*string)(&a.Attributes.BaseCurrency) }),
+	"bic":                            text(func(a *models.Account) *string { return &a.Attributes.Bic }),
+	"country":                        text(func(a *models.Account) *string { return (*string)(&a.Attributes.Country) }),
+	"customer_id":                    text(func(a *models.Account) *string { return &a.Attributes.CustomerID }),
+	"iban":                           text(func(a *models.Account) *string { return &a.Attributes.IBAN }),
+}
+
+// DefaultMapping - every field, each in a column named after it
+func DefaultMapping() Mapping {
+	m := make(Mapping, len(fieldNames))
+	for i, name := range fieldNames {
+		m[i] = Column{Header: name, Field: name}
+	}
+	return m
+}
+
+// ParseMapping - a mapping from "header=field" pairs separated by commas,
+// e.g. "Sort Code=bank_id,Account No=account_number"
+func ParseMapping(s string) (Mapping, error) {
+	var m Mapping
+	for _, pair := range strings.Split(s, ",") {
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("mapping %q should be header=field", pair)
+		}
+		m = append(m, Column{Header: strings.TrimSpace(parts[0]), Field: strings.TrimSpace(parts[1])})
+	}
+	return m, m.validate()
+}
+
+// Headers - the headers of the columns, in order
+func (m Mapping) Headers() []string {
+	headers := make([]string, len(m))
+	for i, c := range m {
+		headers[i] = c.Header
+	}
+	return headers
+}
+
+func (m Mapping) validate() error {
+	headers := map[string]bool{}
+	for _, c := range m {
+		if _, ok := fields[c.Field]; !ok {
+			return fmt.Errorf("unknown field %q for %q", c.Field, c.Header)
+		}
+		if headers[c.Header] {
+			return fmt.Errorf("column %q is mapped twice", c.Header)
+		}
+		headers[c.Header] = true
+	}
+	return nil
+}
+
+// field - the field header is mapped to
+func (m Mapping) field(header string) (string, bool) {
+	for _, c := range m {
+		if c.Header == header {
+			return c.Field, true
+		}
+	}
+	return "", false
+}
+
+func text(ptr func(a *models.Account) *string) field {
+	return field{
+		get: func(a *models.Account) string { return *ptr(a) },
+		set: func(a *models.Account, v string) error {
+			*ptr(a) = v
+			return nil
+		},
+	}
+}
+
+func timestamp(ptr func(a *models.Account) *models.Timestamp) field {
+	return field{
+		get: func(a *models.Account) string {
+			if t := ptr(a); !t.IsZero() {
+				return t.String()
+			}
+			return ""
+		},
+		set: func(a *models.Account, v string) error {
+			if len(v) == 0 {
+				*ptr(a) = models.Timestamp{}
+				return nil
+			}
+			t, err := models.ParseTimestamp(v)
+			if err != nil {
+				return fmt.Errorf("%q isn't an RFC 3339 timestamp", v)
+			}
+			*ptr(a) = t
+			return nil
+		},
+	}
+}
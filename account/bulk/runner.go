@@ -0,0 +1,252 @@
+package bulk
+
+import (
+	"account"
+	"account/internal/atomicfile"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	defaultBatchSize        = 100
+	defaultProgressInterval = 10 * time.Second
+)
+
+type (
+	// Checkpoint - how far an import got, saved after every batch so a
+	// restarted import carries on where it stopped
+	Checkpoint struct {
+		// Offset - the line of the last row processed
+		Offset   int       `json:"offset"`
+		Created  []string  `json:"created"`
+		Failures []Failure `json:"failures"`
+		Updated  time.Time `json:"updated"`
+	}
+
+	// Failure - a row that wasn't created
+	Failure struct {
+		Line  int    `json:"line"`
+		ID    string `json:"id,omitempty"`
+		Error string `json:"error"`
+	}
+
+	// Progress - how an import is going
+	Progress struct {
+		Processed int
+		Created   int
+		Failed    int
+		Elapsed   time.Duration
+		// Rate - rows processed a second in this run
+		Rate float64
+		// ETA - time left, zero when Runner.Total isn't set
+		ETA time.Duration
+	}
+
+	// Runner - imports accounts through Service, checkpointing to the file
+	// at Checkpoint. Running again with the same checkpoint skips the rows
+	// already processed and the ids already created
+	Runner struct {
+		Service    *account.Service
+		Checkpoint string
+		// Source - names what's imported, rows without an id get a (v5) uuid
+		// of it and their line. Defaults to Checkpoint
+		Source string
+		// BatchSize - rows between checkpoints, defaults to 100
+		BatchSize int
+		// Total - rows in the file, when known, for the ETA
+		Total int
+		// ProgressInterval - how often OnProgress is called, defaults to 10s
+		ProgressInterval time.Duration
+		OnProgress       func(Progress)
+	}
+)
+
+// LoadCheckpoint - the checkpoint saved at path, an empty one when there
+// isn't a file yet
+func LoadCheckpoint(path string) (*Checkpoint, error) {
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return &Checkpoint{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	cp := &Checkpoint{}
+	return cp, json.Unmarshal(b, cp)
+}
+
+// Save - writes the checkpoint to path, replacing the previous one in one
+// go so a crash never leaves half a checkpoint
+func (cp *Checkpoint) Save(path string) error {
+	cp.Updated = time.Now().UTC()
+	b, err := json.MarshalIndent(cp, "", "  ")
+	if err != nil {
+		return err
+	}
+	return atomicfile.Write(path, b)
+}
+
+// Run - imports what rd reads, resuming from the checkpoint. Rows without
+// an id are given one derived from Source and their line, so a row created
+// just before a restart gets the same id when it's retried. The account api
+// refuses it as a duplicate, it's counted as created when the existing
+// account is the same and failed otherwise. Returns the final checkpoint,
+// which is also saved when ctx is done or rd fails
+func (r *Runner) Run(ctx context.Context, rd *Reader) (*Checkpoint, error) {
+	cp, err := LoadCheckpoint(r.Checkpoint)
+	if err != nil {
+		return nil, err
+	}
+	created := make(map[string]bool, len(cp.Created))
+	for _, id := range cp.Created {
+		created[id] = true
+	}
+
+	batch := r.BatchSize
+	if batch <= 0 {
+		batch = defaultBatchSize
+	}
+	p := newProgress(r, cp)
+	pending := 0
+	save := func() error {
+		pending = 0
+		return cp.Save(r.Checkpoint)
+	}
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return cp, firstErr(err, save())
+		}
+		rec, err := rd.Next()
+		if err == io.EOF {
+			break
+		}
+		var rowErr *RowError
+		switch {
+		case errors.As(err, &rowErr):
+			if rowErr.Line > cp.Offset {
+				cp.fail(rowErr.Line, rowErr.ID, rowErr.Err)
+				cp.Offset = rowErr.Line
+				pending++
+			}
+		case err != nil:
+			return cp, firstErr(err, save())
+		case rec.Line <= cp.Offset || created[r.id(rec)]:
+			// done in a previous run
+		default:
+			a := rec.Account
+			a.ID = r.id(rec)
+			_, err := r.Service.CreateContext(ctx, a)
+			// a service WithDuplicateRecovery has already fetched and
+			// compared the existing account
+			if account.IsDuplicate(err) && !r.Service.RecoversDuplicates() {
+				_, err = r.Service.RecoverDuplicate(ctx, a, err)
+			}
+			switch {
+			case err == nil:
+				created[a.ID] = true
+				cp.Created = append(cp.Created, a.ID)
+			case ctx.Err() != nil:
+				// cancelled mid create, leave the row for the next run
+				return cp, firstErr(ctx.Err(), save())
+			default:
+				cp.fail(rec.Line, a.ID, err)
+			}
+			cp.Offset = rec.Line
+			pending++
+		}
+
+		if pending >= batch {
+			if err := save(); err != nil {
+				return cp, err
+			}
+		}
+		p.report(cp, false)
+	}
+
+	err = save()
+	p.report(cp, true)
+	return cp, err
+}
+
+// id - the id of the account rec is created as, the same every run
+func (r *Runner) id(rec Record) string {
+	if len(rec.Account.ID) > 0 {
+		return rec.Account.ID
+	}
+	source := r.Source
+	if len(source) == 0 {
+		source = r.Checkpoint
+	}
+	return uuid.NewSHA1(uuid.NameSpaceURL, []byte(source+"#"+strconv.Itoa(rec.Line))).String()
+}
+
+func (cp *Checkpoint) fail(line int, id string, err error) {
+	cp.Failures = append(cp.Failures, Failure{Line: line, ID: id, Error: err.Error()})
+}
+
+// progress - reports progress every interval, the rate is of this run only
+type progress struct {
+	runner   *Runner
+	interval time.Duration
+	start    time.Time
+	last     time.Time
+	startAt  int
+}
+
+func newProgress(r *Runner, cp *Checkpoint) *progress {
+	interval := r.ProgressInterval
+	if interval <= 0 {
+		interval = defaultProgressInterval
+	}
+	now := time.Now()
+	return &progress{runner: r, interval: interval, start: now, last: now, startAt: cp.processed()}
+}
+
+func (p *progress) report(cp *Checkpoint, final bool) {
+	if p.runner.OnProgress == nil {
+		return
+	}
+	now := time.Now()
+	if !final && now.Sub(p.last) < p.interval {
+		return
+	}
+	p.last = now
+
+	processed := cp.processed()
+	pr := Progress{
+		Processed: processed,
+		Created:   len(cp.Created),
+		Failed:    len(cp.Failures),
+		Elapsed:   now.Sub(p.start),
+	}
+	if secs := pr.Elapsed.Seconds(); secs > 0 {
+		pr.Rate = float64(processed-p.startAt) / secs
+	}
+	if left := p.runner.Total - processed; left > 0 && pr.Rate > 0 {
+		pr.ETA = time.Duration(float64(left) / pr.Rate * float64(time.Second))
+	}
+	p.runner.OnProgress(pr)
+}
+
+// processed - rows done, created or failed
+func (cp *Checkpoint) processed() int {
+	return len(cp.Created) + len(cp.Failures)
+}
+
+func firstErr(errs ...error) error {
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"account/bulk"
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// rowsFailedError - some rows of an import weren't created
+type rowsFailedError struct {
+	failed, read int
+}
+
+func (e *rowsFailedError) Error() string {
+	return fmt.Sprintf("%d of %d rows failed", e.failed, e.read)
+}
+
+func importAccounts(e *env, args []string) error {
+	fs := newFlagSet(e, "import [-format csv|jsonl] [-mapping header=field,...] <file>")
+	format := fs.String("format", "", "file format, taken from the file extension when left out")
+	mapping := fs.String("mapping", "", "header=field pairs, the headers are the field names when left out")
+	checkpoint := fs.String("checkpoint", "", "checkpoint file, the import resumes from it when it's run again")
+	progress := fs.Duration("progress", 10*time.Second, "how often progress is reported with -checkpoint")
+	if err := parse(fs, args, 1); err != nil {
+		return err
+	}
+
+	path := fs.Arg(0)
+	f, m, err := bulkOptions(path, *format, *mapping)
+	if err != nil {
+		return err
+	}
+	var in io.Reader = e.stdin
+	if path != "-" {
+		file, err := os.Open(path)
+		if err != nil {
+			return &usageError{err.Error()}
+		}
+		defer file.Close()
+		in = file
+	}
+	r, err := bulk.NewReader(in, f, m)
+	if err != nil {
+		return &usageError{err.Error()}
+	}
+
+	if len(*checkpoint) > 0 {
+		return resumableImport(e, r, path, *checkpoint, *progress)
+	}
+
+	report, err := bulk.Import(e.ctx, e.service, r)
+	if report != nil {
+		for _, rowErr := range report.Errors {
+			fmt.Fprintf(e.stderr, "%s: %v\n", path, rowErr)
+		}
+		fmt.Fprintf(e.stdout, "read %d, created %d, failed %d\n", report.Read, report.Created, len(report.Errors))
+	}
+	if err != nil {
+		return err
+	}
+	if len(report.Errors) > 0 {
+		return &rowsFailedError{failed: len(report.Errors), read: report.Read}
+	}
+	return nil
+}
+
+// resumableImport - imports with a bulk.Runner, reporting progress and the
+// rows that failed in this or earlier runs
+func resumableImport(e *env, r *bulk.Reader, path, checkpoint string, interval time.Duration) error {
+	// ids of rows without one are derived from the file, stdin falls back
+	// to the checkpoint
+	source := ""
+	if path != "-" {
+		source, _ = filepath.Abs(path)
+	}
+	runner := &bulk.Runner{
+		Service:          e.service,
+		Checkpoint:       checkpoint,
+		Source:           source,
+		Total:            countRows(path),
+		ProgressInterval: interval,
+		OnProgress: func(p bulk.Progress) {
+			eta := ""
+			if p.ETA > 0 {
+				eta = fmt.Sprintf(", eta %v", p.ETA.Round(time.Second))
+			}
+			fmt.Fprintf(e.stderr, "processed %d, created %d, failed %d, %.1f rows/s%s\n", p.Processed, p.Created, p.Failed, p.Rate, eta)
+		},
+	}
+
+	// stop at the next row on ctrl-c or a pod stopping, saving the checkpoint
+	ctx, cancel := context.WithCancel(e.ctx)
+	defer cancel()
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(signals)
+	go func() {
+		select {
+		case <-signals:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	cp, err := runner.Run(ctx, r)
+	if cp != nil {
+		for _, f := range cp.Failures {
+			fmt.Fprintf(e.stderr, "%s: line %d (%s): %s\n", path, f.Line, f.ID, f.Error)
+		}
+	}
+	if err != nil {
+		return err
+	}
+	if len(cp.Failures) > 0 {
+		return &rowsFailedError{failed: len(cp.Failures), read: len(cp.Failures) + len(cp.Created)}
+	}
+	return nil
+}
+
+// countRows - the rows in the file at path for the ETA, 0 when it can't be
+// counted. CSV files have a header line
+func countRows(path string) int {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0
+	}
+	defer f.Close()
+
+	lines := 0
+	s := bufio.NewScanner(f)
+	s.Buffer(make([]byte, 64*1024), 1<<20)
+	for s.Scan() {
+		if len(strings.TrimSpace(s.Text())) > 0 {
+			lines++
+		}
+	}
+	if strings.EqualFold(filepath.Ext(path), ".csv") && lines > 0 {
+		lines--
+	}
+	return lines
+}
+
+func exportAccounts(e *env, args []string) error {
+	fs := newFlagSet(e, "export [-format csv|jsonl] [-mapping header=field,...] [-page-size n] [file]")
+	format := fs.String("format", "", "file format, taken from the file extension when left out, csv for stdout")
+	mapping := fs.String("mapping", "", "header=field pairs, every field when left out")
+	size := fs.Int("page-size", 100, "accounts fetched at a time")
+	if err := fs.Parse(args); err != nil {
+		return &usageError{err.Error()}
+	}
+	if fs.NArg() > 1 {
+		fs.Usage()
+		return &usageError{"expected at most one file"}
+	}
+
+	path := fs.Arg(0)
+	f, m, err := bulkOptions(path, *format, *mapping)
+	if err != nil {
+		return err
+	}
+	var out io.Writer = e.stdout
+	if len(path) > 0 && path != "-" {
+		file, err := os.Create(path)
+		if err != nil {
+			return &usageError{err.Error()}
+		}
+		defer file.Close()
+		out = file
+	}
+	w, err := bulk.NewWriter(out, f, m)
+	if err != nil {
+		return &usageError{err.Error()}
+	}
+
+	n, err := bulk.Export(e.ctx, e.service, w, *size)
+	if err != nil {
+		return err
+	}
+	if out != e.stdout {
+		fmt.Fprintf(e.stdout, "exported %d accounts to %s\n", n, path)
+	}
+	return nil
+}
+
+// bulkOptions - the format, from the flag or the file extension, and the
+// mapping, nil for the default one
+func bulkOptions(path, format, mapping string) (bulk.Format, bulk.Mapping, error) {
+	if len(format) == 0 {
+		format = strings.TrimPrefix(filepath.Ext(path), ".")
+		if len(format) == 0 {
+			format = string(bulk.CSV)
+		}
+	}
+	f, err := bulk.ParseFormat(format)
+	if err != nil {
+		return "", nil, &usageError{err.Error()}
+	}
+	if len(mapping) == 0 {
+		return f, nil, nil
+	}
+	m, err := bulk.ParseMapping(mapping)
+	if err != nil {
+		return "", nil, &usageError{err.Error()}
+	}
+	return f, m, nil
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"account"
+	"account/models"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"os"
+)
+
+func get(e *env, args []string) error {
+	fs := newFlagSet(e, "get <id>")
+	if err := parse(fs, args, 1); err != nil {
+		return err
+	}
+	a, err := e.service.GetByID(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	return write(e, []models.Account{*a}, a)
+}
+
+func create(e *env, args []string) error {
+	fs := newFlagSet(e, "create [-file account.json | flags]")
+	file := fs.String("file", "", "json file with the account to create, - for stdin")
+	id := fs.String("id", "", "account id, generated when left out")
+	organisationID := fs.String("organisation-id", "", "organisation id")
+	country := fs.String("country", "", "country, e.g. GB")
+	classification := fs.String("classification", "", "Personal or Business")
+	bankID := fs.String("bank-id", "", "bank id, e.g. the sort code")
+	accountNumber := fs.String("account-number", "", "account number")
+	bic := fs.String("bic", "", "bic")
+	iban := fs.String("iban", "", "iban")
+	customerID := fs.String("customer-id", "", "customer id")
+	if err := parse(fs, args, 0); err != nil {
+		return err
+	}
+
+	var a models.Account
+	var err error
+	if len(*file) > 0 {
+		fs.Visit(func(f *flag.Flag) {
+			if f.Name != "file" && err == nil {
+				err = &usageError{fmt.Sprintf("-%s can't be used with -file, set it in the file", f.Name)}
+			}
+		})
+		if err != nil {
+			return err
+		}
+		a, err = readAccount(e, *file)
+	} else {
+		if len(*country) == 0 {
+			return &usageError{"create needs -file or -country"}
+		}
+		a, err = account.NewBuilder(models.Country(*country)).
+			ID(*id).
+			OrganisationID(*organisationID).
+			Classification(models.Classification(*classification)).
+			BankID(*bankID).
+			AccountNumber(*accountNumber).
+			Bic(*bic).
+			IBAN(*iban).
+			CustomerID(*customerID).
+			Build()
+	}
+	if err != nil {
+		return err
+	}
+
+	created, err := e.service.Create(a)
+	if err != nil {
+		return err
+	}
+	return write(e, []models.Account{*created}, created)
+}
+
+func remove(e *env, args []string) error {
+	fs := newFlagSet(e, "delete [-version n] <id>")
+	version := fs.Int("version", 0, "version of the account to delete")
+	if err := parse(fs, args, 1); err != nil {
+		return err
+	}
+	if *version < 0 || *version > math.MaxInt32 {
+		return &usageError{"-version must be from 0 to 2147483647"}
+	}
+	if err := e.service.DeleteContext(e.ctx, fs.Arg(0), int32(*version)); err != nil {
+		return err
+	}
+	fmt.Fprintf(e.stdout, "deleted %s\n", fs.Arg(0))
+	return nil
+}
+
+func list(e *env, args []string) error {
+	fs := newFlagSet(e, "list [flags]")
+	page := fs.Int("page", 1, "page number, from 1")
+	size := fs.Int("page-size", 100, "accounts per page")
+	var f filter
+	fs.StringVar(&f.organisationID, "organisation-id", "", "only accounts in this organisation")
+	fs.StringVar(&f.country, "country", "", "only accounts in this country")
+	fs.StringVar(&f.classification, "classification", "", "only Personal or Business accounts")
+	fs.StringVar(&f.bankIDCode, "bank-id-code", "", "only accounts with this bank id code")
+	if err := parse(fs, args, 0); err != nil {
+		return err
+	}
+	if *page < 1 || *size < 1 {
+		return &usageError{"-page and -page-size must be at least 1"}
+	}
+
+	// the account api doesn't filter, so the filters are applied to every
+	// account and the matches paged here
+	all, err := e.service.List(1, math.MaxInt32)
+	if err != nil {
+		return err
+	}
+	matches := []models.Account{}
+	for _, a := range all {
+		if f.match(a) {
+			matches = append(matches, a)
+		}
+	}
+	start := (*page - 1) * *size
+	if start > len(matches) {
+		start = len(matches)
+	}
+	stop := start + *size
+	if stop > len(matches) {
+		stop = len(matches)
+	}
+	return write(e, matches[start:stop], matches[start:stop])
+}
+
+func version(e *env, args []string) error {
+	fs := newFlagSet(e, "version")
+	if err := parse(fs, args, 0); err != nil {
+		return err
+	}
+	fmt.Fprintf(e.stdout, "accountctl %s\n", account.Version)
+	return nil
+}
+
+// filter - the list filters, empty ones match everything
+type filter struct {
+	organisationID string
+	country        string
+	classification string
+	bankIDCode     string
+}
+
+func (f filter) match(a models.Account) bool {
+	return matches(f.organisationID, a.OrganisationID) &&
+		matches(f.country, string(a.Attributes.Country)) &&
+		matches(f.classification, string(a.Attributes.AccountClassification)) &&
+		matches(f.bankIDCode, string(a.Attributes.BankIDCode))
+}
+
+func matches(want, got string) bool {
+	return len(want) == 0 || want == got
+}
+
+func newFlagSet(e *env, usage string) *flag.FlagSet {
+	fs := flag.NewFlagSet(usage, flag.ContinueOnError)
+	fs.SetOutput(e.stderr)
+	fs.Usage = func() {
+		fmt.Fprintf(e.stderr, "usage: accountctl %s\n", usage)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// parse - parses the flags and checks exactly positional arguments follow
+func parse(fs *flag.FlagSet, args []string, positional int) error {
+	if err := fs.Parse(args); err != nil {
+		return &usageError{err.Error()}
+	}
+	if fs.NArg() != positional {
+		fs.Usage()
+		return &usageError{fmt.Sprintf("expected %d argument(s), got %d", positional, fs.NArg())}
+	}
+	return nil
+}
+
+// readAccount - an account from a json file, either the account itself or
+// wrapped in "data" as the account api sends it
+func readAccount(e *env, path string) (models.Account, error) {
+	var r io.Reader = e.stdin
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return models.Account{}, &usageError{err.Error()}
+		}
+		defer f.Close()
+		r = f
+	}
+
+	var body struct {
+		models.Account
+		Data *models.Account `json:"data"`
+	}
+	if err := json.NewDecoder(r).Decode(&body); err != nil {
+		return models.Account{}, &usageError{fmt.Sprintf("reading %s: %v", path, err)}
+	}
+	if body.Data != nil {
+		return *body.Data, nil
+	}
+	return body.Account, nil
+}
@@ -0,0 +1,169 @@
+// Command accountctl - gets, creates, deletes, lists, imports, exports,
+// snapshots and reconciles accounts from the command line through
+// account.Service
+//
+//	accountctl [-base-url url] [-token token] [-output table|json|yaml] <command> [flags]
+//
+// The base url and token can also be set with ACCOUNT_API_BASE_URL and
+// ACCOUNT_API_TOKEN. The exit code tells apart a missing account (3), an
+// invalid account or arguments (2) and the account api being unreachable (4)
+package main
+
+import (
+	"account"
+	"account/infrastructure"
+	"account/infrastructure/chaos"
+	"account/infrastructure/middleware"
+	"account/models"
+	"account/modulus"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+)
+
+// Exit codes
+const (
+	exitOK = iota
+	exitError
+	exitInvalid
+	exitNotFound
+	exitTransport
+)
+
+const defaultBaseURL = "http://localhost:8080"
+
+// usageError - the command line was wrong
+type usageError struct {
+	msg string
+}
+
+func (e *usageError) Error() string {
+	return e.msg
+}
+
+// env - the command line, outputs and environment a command runs with
+type env struct {
+	ctx     context.Context
+	stdout  io.Writer
+	stderr  io.Writer
+	stdin   io.Reader
+	getenv  func(string) string
+	service *account.Service
+	output  string
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], &env{stdout: os.Stdout, stderr: os.Stderr, stdin: os.Stdin, getenv: os.Getenv}))
+}
+
+var commands = map[string]func(e *env, args []string) error{
+	"get":       get,
+	"create":    create,
+	"delete":    remove,
+	"list":      list,
+	"import":    importAccounts,
+	"export":    exportAccounts,
+	"snapshot":  takeSnapshot,
+	"diff":      diff,
+	"reconcile": reconcileAccounts,
+	"version":   version,
+}
+
+func run(args []string, e *env) int {
+	fs := flag.NewFlagSet("accountctl", flag.ContinueOnError)
+	fs.SetOutput(e.stderr)
+	baseURL := fs.String("base-url", envOr(e, "ACCOUNT_API_BASE_URL", defaultBaseURL), "account api base url, or ACCOUNT_API_BASE_URL")
+	token := fs.String("token", e.getenv("ACCOUNT_API_TOKEN"), "bearer token, or ACCOUNT_API_TOKEN")
+	timeout := fs.Duration("timeout", 30*time.Second, "how long to wait for the account api")
+	chaosConfig := fs.String("chaos", "", "json file of chaos rules to inject failures with")
+	fs.StringVar(&e.output, "output", "table", "output format: table, json or yaml")
+	fs.Usage = func() {
+		fmt.Fprintln(e.stderr, "usage: accountctl [flags] get|create|delete|list|import|export|snapshot|diff|reconcile|version [flags]")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return exitInvalid
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return exitInvalid
+	}
+	cmd, ok := commands[fs.Arg(0)]
+	if !ok {
+		fmt.Fprintf(e.stderr, "accountctl: unknown command %q\n", fs.Arg(0))
+		fs.Usage()
+		return exitInvalid
+	}
+	if _, ok := formatters[e.output]; !ok {
+		fmt.Fprintf(e.stderr, "accountctl: unknown output %q\n", e.output)
+		return exitInvalid
+	}
+
+	u, err := url.Parse(*baseURL)
+	if err != nil {
+		fmt.Fprintf(e.stderr, "accountctl: invalid base url: %v\n", err)
+		return exitInvalid
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+	e.ctx = ctx
+	client := &http.Client{}
+	if len(*chaosConfig) > 0 {
+		c, err := chaos.LoadConfig(*chaosConfig)
+		if err == nil {
+			client.Transport, err = chaos.New(nil, c)
+		}
+		if err != nil {
+			fmt.Fprintf(e.stderr, "accountctl: invalid chaos rules: %v\n", err)
+			return exitInvalid
+		}
+	}
+	h := infrastructure.NewHTTP(ctx, client, u, "accountctl/"+account.Version)
+	if len(*token) > 0 {
+		h.Middleware = append(h.Middleware, middleware.BearerToken(*token))
+	}
+	e.service = account.NewService(h)
+
+	if err := cmd(e, fs.Args()[1:]); err != nil {
+		fmt.Fprintf(e.stderr, "accountctl: %v\n", err)
+		return exitCode(err)
+	}
+	return exitOK
+}
+
+// exitCode - what kind of failure err is
+func exitCode(err error) int {
+	var usage *usageError
+	var rowsFailed *rowsFailedError
+	var apiErr *infrastructure.APIError
+	var unknown *models.UnknownValueError
+	var invalid *account.ValidationError
+	var urlErr *url.Error
+	var netErr net.Error
+	switch {
+	case errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound:
+		return exitNotFound
+	case errors.As(err, &usage), errors.As(err, &rowsFailed), errors.As(err, &unknown), errors.As(err, &invalid),
+		errors.Is(err, modulus.ErrInvalid), errors.Is(err, modulus.ErrFormat),
+		errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusBadRequest:
+		return exitInvalid
+	case errors.As(err, &urlErr), errors.As(err, &netErr), errors.Is(err, infrastructure.ErrCircuitOpen),
+		errors.Is(err, context.DeadlineExceeded):
+		return exitTransport
+	}
+	return exitError
+}
+
+func envOr(e *env, key, fallback string) string {
+	if v := e.getenv(key); len(v) > 0 {
+		return v
+	}
+	return fallback
+}
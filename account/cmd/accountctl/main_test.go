@@ -0,0 +1,157 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const okAccount = `{
+	"data": {
+		"attributes": {
+			"account_classification": "Personal",
+			"account_number": "10000004",
+			"bank_id": "400302",
+			"bank_id_code": "GBDSC",
+			"base_currency": "GBP",
+			"bic": "NWBKGB42",
+			"country": "GB",
+			"iban": "GB28NWBK40030212764204"
+		},
+		"created_on": "2020-08-25T21:24:39.999Z",
+		"id": "ad27e265-9605-4b4b-a0e5-3003ea9cc4dc",
+		"modified_on": "2020-08-25T21:24:39.999Z",
+		"organisation_id": "eb0bd6f5-c3f5-44b2-b677-acd23cdde73c",
+		"type": "accounts"
+	}
+}`
+
+func runWith(t *testing.T, h http.Handler, args ...string) (int, string, string) {
+	t.Helper()
+	s := httptest.NewServer(h)
+	defer s.Close()
+
+	var stdout, stderr bytes.Buffer
+	e := &env{
+		stdout: &stdout,
+		stderr: &stderr,
+		stdin:  strings.NewReader(""),
+		getenv: func(key string) string {
+			if key == "ACCOUNT_API_BASE_URL" {
+				return s.URL
+			}
+			return ""
+		},
+	}
+	code := run(args, e)
+	return code, stdout.String(), stderr.String()
+}
+
+func TestGetOutputs(t *testing.T) {
+	var auth string
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth = r.Header.Get("Authorization")
+		w.Write([]byte(okAccount))
+	})
+
+	code, out, _ := runWith(t, h, "-token", "secret", "get", "ad27e265-9605-4b4b-a0e5-3003ea9cc4dc")
+	if code != exitOK || !strings.Contains(out, "GB28NWBK40030212764204") || !strings.HasPrefix(out, "ID") {
+		t.Errorf("get returned %d with %q, expected a table with the account", code, out)
+	}
+	if auth != "Bearer secret" {
+		t.Errorf("get sent Authorization %q, expected the bearer token", auth)
+	}
+
+	_, out, _ = runWith(t, h, "-output", "json", "get", "ad27e265-9605-4b4b-a0e5-3003ea9cc4dc")
+	if !strings.Contains(out, `"bank_id_code": "GBDSC"`) {
+		t.Errorf("get -output json returned %q", out)
+	}
+
+	_, out, _ = runWith(t, h, "-output", "yaml", "get", "ad27e265-9605-4b4b-a0e5-3003ea9cc4dc")
+	want := "attributes:\n  account_classification: Personal\n  account_number: \"10000004\"\n"
+	if !strings.HasPrefix(out, want) || !strings.Contains(out, "\ncreated_on: \"2020-08-25T21:24:39.999Z\"\n") {
+		t.Errorf("get -output yaml returned %q", out)
+	}
+}
+
+func TestListFiltersAndPages(t *testing.T) {
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"data": [
+			{"id": "1", "attributes": {"country": "GB"}},
+			{"id": "2", "attributes": {"country": "FR"}},
+			{"id": "3", "attributes": {"country": "GB"}},
+			{"id": "4", "attributes": {"country": "GB"}}
+		]}`))
+	})
+
+	code, out, _ := runWith(t, h, "-output", "yaml", "list", "-country", "GB", "-page", "2", "-page-size", "2")
+	if code != exitOK || out != "- attributes:\n    bic: \"\"\n    country: GB\n  id: \"4\"\n" {
+		t.Errorf("list returned %d with %q, expected the third GB account", code, out)
+	}
+}
+
+func TestDeleteSendsVersion(t *testing.T) {
+	var query string
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query = r.URL.RawQuery
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	code, out, _ := runWith(t, h, "delete", "-version", "3", "ad27e265-9605-4b4b-a0e5-3003ea9cc4dc")
+	if code != exitOK || query != "version=3" || out != "deleted ad27e265-9605-4b4b-a0e5-3003ea9cc4dc\n" {
+		t.Errorf("delete returned %d with %q and sent %q, expected version=3", code, out, query)
+	}
+}
+
+func TestSnapshotKeepsTheLastOneWhenItFails(t *testing.T) {
+	dir, err := ioutil.TempDir("", "accountctl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "monday.jsonl")
+	ioutil.WriteFile(path, []byte("last good snapshot\n"), 0644)
+
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"data": [`))
+	})
+	if code, _, _ := runWith(t, h, "snapshot", path); code == exitOK {
+		t.Errorf("snapshot of a broken response exited with %d, expected it to fail", code)
+	}
+	if b, _ := ioutil.ReadFile(path); string(b) != "last good snapshot\n" {
+		t.Errorf("the failed snapshot left %q, expected the last good one", b)
+	}
+	if files, _ := ioutil.ReadDir(dir); len(files) != 1 {
+		t.Errorf("the failed snapshot left %d files, expected 1", len(files))
+	}
+}
+
+func TestExitCodes(t *testing.T) {
+	notFound := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`{"error_message": "record 1 does not exist"}`))
+	})
+	if code, _, _ := runWith(t, notFound, "get", "1"); code != exitNotFound {
+		t.Errorf("get of a missing account exited with %d, expected %d", code, exitNotFound)
+	}
+	if code, _, _ := runWith(t, notFound, "create", "-country", "GB", "-bank-id", "4003"); code != exitInvalid {
+		t.Errorf("create of an invalid account exited with %d, expected %d", code, exitInvalid)
+	}
+	if code, _, _ := runWith(t, notFound, "create", "-file", "-", "-country", "GB"); code != exitInvalid {
+		t.Errorf("create with -file and -country exited with %d, expected %d", code, exitInvalid)
+	}
+	if code, _, _ := runWith(t, notFound, "get"); code != exitInvalid {
+		t.Errorf("get without an id exited with %d, expected %d", code, exitInvalid)
+	}
+
+	var stderr bytes.Buffer
+	e := &env{stdout: &bytes.Buffer{}, stderr: &stderr, getenv: func(string) string { return "" }}
+	if code := run([]string{"-base-url", "http://127.0.0.1:1", "get", "1"}, e); code != exitTransport {
+		t.Errorf("get from an unreachable api exited with %d, expected %d: %s", code, exitTransport, stderr.String())
+	}
+}
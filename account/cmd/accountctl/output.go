@@ -0,0 +1,167 @@
+package main
+
+import (
+	"account/models"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+// formatters - write the accounts a command returns, v is what the account
+// api returned (one account or a list)
+var formatters = map[string]func(w io.Writer, accounts []models.Account, v interface{}) error{
+	"table": writeTable,
+	"json":  writeJSON,
+	"yaml":  writeYAML,
+}
+
+func write(e *env, accounts []models.Account, v interface{}) error {
+	return formatters[e.output](e.stdout, accounts, v)
+}
+
+func writeTable(w io.Writer, accounts []models.Account, _ interface{}) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tORGANISATION\tCOUNTRY\tCLASSIFICATION\tBANK ID\tACCOUNT NUMBER\tIBAN\tCREATED")
+	for _, a := range accounts {
+		created := ""
+		if !a.CreatedOn.IsZero() {
+			created = a.CreatedOn.String()
+		}
+		attr := a.Attributes
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n", a.ID, a.OrganisationID, attr.Country,
+			attr.AccountClassification, attr.BankID, attr.AccountNumber, attr.IBAN, created)
+	}
+	return tw.Flush()
+}
+
+func writeJSON(w io.Writer, _ []models.Account, v interface{}) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+// writeYAML - v encoded as json and rewritten as yaml, keeping the order
+// the json fields are in
+func writeYAML(w io.Writer, _ []models.Account, v interface{}) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	var sb strings.Builder
+	if err := yamlValue(&sb, dec, 0, false); err != nil {
+		return err
+	}
+	_, err = io.WriteString(w, sb.String())
+	return err
+}
+
+// yamlValue - writes the next json value as yaml. inline is set when the
+// value follows a "key:" or "- " on the same line
+func yamlValue(sb *strings.Builder, dec *json.Decoder, indent int, inline bool) error {
+	tok, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	pad := strings.Repeat("  ", indent)
+
+	switch tok {
+	case json.Delim('{'):
+		first := true
+		for dec.More() {
+			key, err := dec.Token()
+			if err != nil {
+				return err
+			}
+			if !first || !inline {
+				sb.WriteString(pad)
+			}
+			first = false
+			fmt.Fprintf(sb, "%s:", yamlScalar(key.(string)))
+			if err := yamlNested(sb, dec, indent, false); err != nil {
+				return err
+			}
+		}
+		if first {
+			writeLine(sb, "{}")
+		}
+		_, err = dec.Token()
+		return err
+	case json.Delim('['):
+		first := true
+		for dec.More() {
+			if !first || !inline {
+				sb.WriteString(pad)
+			}
+			first = false
+			sb.WriteString("-")
+			if err := yamlNested(sb, dec, indent, true); err != nil {
+				return err
+			}
+		}
+		if first {
+			writeLine(sb, "[]")
+		}
+		_, err = dec.Token()
+		return err
+	case nil:
+		writeLine(sb, "null")
+	default:
+		switch t := tok.(type) {
+		case string:
+			writeLine(sb, yamlScalar(t))
+		default:
+			writeLine(sb, fmt.Sprint(t))
+		}
+	}
+	return nil
+}
+
+// yamlNested - writes a value that follows "key:" or "-". Maps and lists
+// under a key go on the lines below, everything else (and the first line of
+// a list item) on the same line
+func yamlNested(sb *strings.Builder, dec *json.Decoder, indent int, item bool) error {
+	// decode the raw value to see what it is, then write it from its own decoder
+	var raw json.RawMessage
+	if err := dec.Decode(&raw); err != nil {
+		return err
+	}
+	nested := json.NewDecoder(bytes.NewReader(raw))
+	nested.UseNumber()
+	trimmed := bytes.TrimSpace(raw)
+	if !item && len(trimmed) > 2 && (trimmed[0] == '{' || trimmed[0] == '[') {
+		sb.WriteString("\n")
+		return yamlValue(sb, nested, indent+1, false)
+	}
+	sb.WriteString(" ")
+	return yamlValue(sb, nested, indent+1, true)
+}
+
+func writeLine(sb *strings.Builder, s string) {
+	sb.WriteString(s)
+	sb.WriteString("\n")
+}
+
+// yamlScalar - s quoted when yaml would read it as something other than
+// the string it is
+func yamlScalar(s string) string {
+	if len(s) == 0 || strings.ContainsAny(s, ":#{}[],&*!|>'\"%@`\n") || strings.TrimSpace(s) != s {
+		return strconv.Quote(s)
+	}
+	switch strings.ToLower(s) {
+	case "true", "false", "yes", "no", "on", "off", "null", "~":
+		return strconv.Quote(s)
+	}
+	if _, err := strconv.ParseFloat(s, 64); err == nil {
+		return strconv.Quote(s)
+	}
+	if strings.HasPrefix(s, "-") || strings.HasPrefix(s, "?") {
+		return strconv.Quote(s)
+	}
+	return s
+}
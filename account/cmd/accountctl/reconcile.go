@@ -0,0 +1,48 @@
+package main
+
+import (
+	"account/bulk"
+	"account/reconcile"
+	"os"
+)
+
+// reconcileAccounts - compares an expected set of accounts with the account
+// api, only changing anything with -apply
+func reconcileAccounts(e *env, args []string) error {
+	fs := newFlagSet(e, "reconcile [-format csv|jsonl] [-mapping header=field,...] [-organisation-id id] [-apply] <expected file>")
+	format := fs.String("format", "", "file format, taken from the file extension when left out")
+	mapping := fs.String("mapping", "", "header=field pairs, the headers are the field names when left out")
+	organisationID := fs.String("organisation-id", "", "only reconcile accounts in this organisation")
+	apply := fs.Bool("apply", false, "create missing accounts and delete unexpected ones, by default nothing is changed")
+	size := fs.Int("page-size", 100, "accounts fetched at a time")
+	if err := parse(fs, args, 1); err != nil {
+		return err
+	}
+
+	path := fs.Arg(0)
+	f, m, err := bulkOptions(path, *format, *mapping)
+	if err != nil {
+		return err
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return &usageError{err.Error()}
+	}
+	defer file.Close()
+	r, err := bulk.NewReader(file, f, m)
+	if err != nil {
+		return &usageError{err.Error()}
+	}
+	// the ledger is the source of truth, its rows are taken as they are
+	r.Validate = nil
+
+	rec := &reconcile.Reconciler{Service: e.service, OrganisationID: *organisationID, Apply: *apply, PageSize: *size}
+	report, err := rec.Run(e.ctx, reconcile.FromReader(r))
+	if err != nil {
+		return err
+	}
+	if e.output == "table" {
+		return report.WriteText(e.stdout)
+	}
+	return formatters[e.output](e.stdout, nil, report)
+}
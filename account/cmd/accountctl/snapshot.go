@@ -0,0 +1,77 @@
+package main
+
+import (
+	"account/internal/atomicfile"
+	"account/snapshot"
+	"fmt"
+	"io"
+	"os"
+)
+
+func takeSnapshot(e *env, args []string) error {
+	fs := newFlagSet(e, "snapshot [-organisation-id id] [-page-size n] <file>")
+	organisationID := fs.String("organisation-id", "", "only accounts in this organisation")
+	size := fs.Int("page-size", 100, "accounts fetched at a time")
+	if err := parse(fs, args, 1); err != nil {
+		return err
+	}
+
+	path := fs.Arg(0)
+	if path == "-" {
+		_, err := snapshot.Take(e.ctx, e.service, e.stdout, *organisationID, *size)
+		return err
+	}
+
+	// written to a temporary file and renamed over path, so a failed
+	// snapshot doesn't replace the last good one
+	var n int
+	var takeErr error
+	err := atomicfile.WriteFunc(path, func(w io.Writer) error {
+		n, takeErr = snapshot.Take(e.ctx, e.service, w, *organisationID, *size)
+		return takeErr
+	})
+	if takeErr != nil {
+		return takeErr
+	}
+	if err != nil {
+		return &usageError{err.Error()}
+	}
+	fmt.Fprintf(e.stdout, "saved %d accounts to %s\n", n, path)
+	return nil
+}
+
+// diff - compares two snapshots, written as text for -output table and in
+// the output format otherwise
+func diff(e *env, args []string) error {
+	fs := newFlagSet(e, "diff <old snapshot> <new snapshot>")
+	if err := parse(fs, args, 2); err != nil {
+		return err
+	}
+
+	old, err := readSnapshot(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	new, err := readSnapshot(fs.Arg(1))
+	if err != nil {
+		return err
+	}
+	d := snapshot.Compare(old, new)
+	if e.output == "table" {
+		return d.WriteText(e.stdout)
+	}
+	return formatters[e.output](e.stdout, nil, d)
+}
+
+func readSnapshot(path string) (*snapshot.Snapshot, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, &usageError{err.Error()}
+	}
+	defer f.Close()
+	s, err := snapshot.Read(f)
+	if err != nil {
+		return nil, &usageError{fmt.Sprintf("%s: %v", path, err)}
+	}
+	return s, nil
+}
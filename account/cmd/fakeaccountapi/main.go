@@ -0,0 +1,104 @@
+// Command fakeaccountapi - serves a fake of the account api, see package
+// fakeapi, so the client and its integration tests can run against a single
+// process
+//
+//	fakeaccountapi [-addr :8080] [-data accounts.json] [-faults faults.json]
+//
+// With -data the accounts are kept in the json file and survive a restart,
+// without it they're lost when the process stops. -faults starts it with
+// fakeapi.Faults injected, they can be changed at /admin/faults while it runs
+package main
+
+import (
+	"account/fakeapi"
+	"bufio"
+	"context"
+	"encoding/json"
+	"flag"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+func main() {
+	addr := flag.String("addr", ":8080", "address to listen on")
+	data := flag.String("data", "", "json file the accounts are kept in, in memory when empty")
+	faults := flag.String("faults", "", "json file of the faults to inject")
+	flag.Parse()
+
+	store := fakeapi.NewStore()
+	if len(*data) > 0 {
+		var err error
+		if store, err = fakeapi.OpenStore(*data); err != nil {
+			log.Fatalf("opening %s: %v", *data, err)
+		}
+	}
+
+	server := fakeapi.NewServer(store)
+	if len(*faults) > 0 {
+		if err := loadFaults(server, *faults); err != nil {
+			log.Fatalf("loading faults from %s: %v", *faults, err)
+		}
+	}
+
+	srv := &http.Server{Addr: *addr, Handler: logRequests(server)}
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-stop
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		srv.Shutdown(ctx)
+	}()
+
+	log.Printf("fake account api listening on %s", *addr)
+	if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		log.Fatal(err)
+	}
+}
+
+func loadFaults(server *fakeapi.Server, path string) error {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var f fakeapi.Faults
+	if err := json.Unmarshal(b, &f); err != nil {
+		return err
+	}
+	return server.SetFaults(f)
+}
+
+// statusRecorder - keeps the status written so it can be logged
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// Hijack - lets injected connection resets through
+func (r *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hj, ok := r.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, http.ErrNotSupported
+	}
+	return hj.Hijack()
+}
+
+func logRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r)
+		log.Printf("%s %s %d %s", r.Method, r.URL.RequestURI(), rec.status, time.Since(start))
+	})
+}
@@ -0,0 +1,281 @@
+package fakeapi
+
+import (
+	"account/internal/duration"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// AdminPath - where the faults are read (GET), replaced (PUT) and cleared
+// (DELETE) while the server runs. It's never faulted itself
+const AdminPath = "/admin/faults"
+
+// Routes faults are configured for, "*" is used for routes without their own
+const (
+	RouteGet    = "get"
+	RouteList   = "list"
+	RouteCreate = "create"
+	RouteDelete = "delete"
+	RoutePatch  = "patch"
+	RouteAll    = "*"
+)
+
+const (
+	defaultDelay      = time.Second
+	defaultStatus     = http.StatusServiceUnavailable
+	defaultRetryAfter = 1
+)
+
+// outcomes of a faulted request, besides being delayed
+const (
+	served outcome = iota
+	reset
+	serverError
+	tooManyRequests
+	truncated
+	malformed
+)
+
+type (
+	// Faults - the faults injected by route. Requests draw from a random
+	// source seeded with Seed, so the same requests made one after another
+	// see the same faults every run
+	Faults struct {
+		Seed   int64            `json:"seed"`
+		Routes map[string]Fault `json:"routes,omitempty"`
+	}
+
+	// Fault - the probability, 0 to 1, of each fault on a route. Latency is
+	// drawn on its own, then at most one of the others happens so their sum
+	// can't be more than 1
+	Fault struct {
+		Latency float64 `json:"latency,omitempty"`
+		// Delay - added by Latency, defaults to 1s
+		Delay Duration `json:"delay,omitempty"`
+		// ServerError - answers with Status without handling the request
+		ServerError float64 `json:"server_error,omitempty"`
+		// Status - the 5xx status of ServerError, defaults to 503
+		Status int `json:"status,omitempty"`
+		// TooManyRequests - answers 429 with a Retry-After of RetryAfter
+		// seconds, defaults to 1, without handling the request
+		TooManyRequests float64 `json:"too_many_requests,omitempty"`
+		RetryAfter      int     `json:"retry_after,omitempty"`
+		// Reset - resets the connection without handling the request
+		Reset float64 `json:"reset,omitempty"`
+		// Truncate - handles the request, then closes the connection half
+		// way through a body announced at its full length
+		Truncate float64 `json:"truncate,omitempty"`
+		// Malformed - handles the request, then sends half of the body as
+		// if it were all of it
+		Malformed float64 `json:"malformed,omitempty"`
+	}
+
+	// Duration - a time.Duration written as in "250ms" in json
+	Duration = duration.Duration
+
+	outcome int
+
+	// bufferedResponse - holds a response so it can be spoilt before it's
+	// sent
+	bufferedResponse struct {
+		header http.Header
+		status int
+		body   bytes.Buffer
+	}
+)
+
+// SetFaults - replaces the faults injected, restarting the random source
+// from their seed
+func (s *Server) SetFaults(f Faults) error {
+	if err := f.Validate(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.faults = f
+	s.rng = rand.New(rand.NewSource(f.Seed))
+	return nil
+}
+
+// Faults - the faults injected
+func (s *Server) Faults() Faults {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.faults
+}
+
+// Validate - every probability is between 0 and 1 and those of the faults
+// that exclude each other add up to no more than 1
+func (f Faults) Validate() error {
+	for route, fault := range f.Routes {
+		for _, p := range []float64{fault.Latency, fault.ServerError, fault.TooManyRequests, fault.Reset, fault.Truncate, fault.Malformed} {
+			if p < 0 || p > 1 {
+				return fmt.Errorf("route %s: probabilities must be between 0 and 1", route)
+			}
+		}
+		exclusive := fault.ServerError + fault.TooManyRequests + fault.Reset + fault.Truncate + fault.Malformed
+		if exclusive > 1 {
+			return fmt.Errorf("route %s: server_error, too_many_requests, reset, truncate and malformed add up to more than 1", route)
+		}
+		if fault.Status != 0 && (fault.Status < 500 || fault.Status > 599) {
+			return fmt.Errorf("route %s: status %d isn't a 5xx", route, fault.Status)
+		}
+	}
+	return nil
+}
+
+// admin - reads, replaces or clears the faults
+func (s *Server) admin(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut:
+		var f Faults
+		if err := json.NewDecoder(r.Body).Decode(&f); err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid faults: %v", err))
+			return
+		}
+		if err := s.SetFaults(f); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	case http.MethodDelete:
+		s.SetFaults(Faults{})
+	default:
+		methodNotAllowed(w, "GET, PUT, DELETE")
+		return
+	}
+	writeJSON(w, http.StatusOK, s.Faults())
+}
+
+// inject - serves the request with whatever faults it draws
+func (s *Server) inject(w http.ResponseWriter, r *http.Request, f Fault) {
+	delay, o := s.draw(f)
+	if delay > 0 {
+		t := time.NewTimer(delay)
+		select {
+		case <-r.Context().Done():
+			t.Stop()
+			return
+		case <-t.C:
+		}
+	}
+
+	switch o {
+	case reset:
+		resetConnection(w)
+	case serverError:
+		status := f.Status
+		if status == 0 {
+			status = defaultStatus
+		}
+		writeError(w, status, "injected server error")
+	case tooManyRequests:
+		retryAfter := f.RetryAfter
+		if retryAfter <= 0 {
+			retryAfter = defaultRetryAfter
+		}
+		w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+		writeError(w, http.StatusTooManyRequests, "too many requests")
+	case truncated, malformed:
+		buf := &bufferedResponse{header: http.Header{}, status: http.StatusOK}
+		s.serve(buf, r)
+		buf.spoil(w, o)
+	default:
+		s.serve(w, r)
+	}
+}
+
+// draw - whether the request is delayed and what else happens to it. Both
+// are always drawn so every request takes the same amount from the source
+func (s *Server) draw(f Fault) (time.Duration, outcome) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var delay time.Duration
+	if s.rng.Float64() < f.Latency {
+		delay = time.Duration(f.Delay)
+		if delay <= 0 {
+			delay = defaultDelay
+		}
+	}
+
+	x := s.rng.Float64()
+	for _, o := range []struct {
+		p float64
+		o outcome
+	}{
+		{f.Reset, reset},
+		{f.ServerError, serverError},
+		{f.TooManyRequests, tooManyRequests},
+		{f.Truncate, truncated},
+		{f.Malformed, malformed},
+	} {
+		if x < o.p {
+			return delay, o.o
+		}
+		x -= o.p
+	}
+	return delay, served
+}
+
+// fault - the fault configured for the request's route, if any
+func (s *Server) fault(r *http.Request) (Fault, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if f, ok := s.faults.Routes[route(r)]; ok {
+		return f, true
+	}
+	f, ok := s.faults.Routes[RouteAll]
+	return f, ok
+}
+
+// resetConnection - closes the connection with a RST rather than a FIN, so
+// the client sees "connection reset by peer"
+func resetConnection(w http.ResponseWriter) {
+	hj, ok := w.(http.Hijacker)
+	if !ok {
+		panic(http.ErrAbortHandler)
+	}
+	conn, _, err := hj.Hijack()
+	if err != nil {
+		panic(http.ErrAbortHandler)
+	}
+	if tcp, ok := conn.(*net.TCPConn); ok {
+		tcp.SetLinger(0)
+	}
+	conn.Close()
+}
+
+func (b *bufferedResponse) Header() http.Header {
+	return b.header
+}
+
+func (b *bufferedResponse) WriteHeader(status int) {
+	b.status = status
+}
+
+func (b *bufferedResponse) Write(p []byte) (int, error) {
+	return b.body.Write(p)
+}
+
+// spoil - sends half the body, announced at its full length when truncated
+// so the connection is cut short, or as all there is when malformed
+func (b *bufferedResponse) spoil(w http.ResponseWriter, o outcome) {
+	for k, v := range b.header {
+		w.Header()[k] = v
+	}
+	body := b.body.Bytes()
+	half := body[:len(body)/2]
+	length := len(half)
+	if o == truncated {
+		length = len(body)
+	}
+	w.Header().Set("Content-Length", strconv.Itoa(length))
+	w.WriteHeader(b.status)
+	w.Write(half)
+}
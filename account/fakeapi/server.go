@@ -0,0 +1,442 @@
+// Package fakeapi - a stand in for the account api, keeping accounts in
+// memory or in a json file, so the client and its integration tests can run
+// without the account api, Postgres and Vault
+//
+// It serves create, fetch, list (paged and filtered), delete (with version)
+// and patch under /v1/organisation/accounts, answering errors with the
+// account api's {"error_message": ...} bodies
+package fakeapi
+
+import (
+	"account/models"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	accountsPath    = "/v1/organisation/accounts"
+	accountType     = "accounts"
+	defaultPageSize = 100
+)
+
+type (
+	// Server - an http.Handler serving the accounts in its Store, with the
+	// faults set with SetFaults or through AdminPath
+	Server struct {
+		store  *Store
+		mu     sync.Mutex
+		faults Faults
+		rng    *rand.Rand
+	}
+
+	request struct {
+		Data json.RawMessage `json:"data"`
+	}
+
+	response struct {
+		Data  interface{}       `json:"data"`
+		Links map[string]string `json:"links,omitempty"`
+	}
+
+	errorResponse struct {
+		ErrorMessage string `json:"error_message"`
+	}
+
+	// patch - the fields a patch can change, attributes are merged into the
+	// account's so only the ones sent change
+	patch struct {
+		ID         string          `json:"id"`
+		Version    *int32          `json:"version"`
+		Attributes json.RawMessage `json:"attributes"`
+	}
+)
+
+// filters - the list filters, filter[name] in the query, by field
+var filters = map[string]func(a models.Account) string{
+	"organisation_id": func(a models.Account) string { return a.OrganisationID },
+	"account_number":  func(a models.Account) string { return a.Attributes.AccountNumber },
+	"bank_id":         func(a models.Account) string { return a.Attributes.BankID },
+	"bank_id_code":    func(a models.Account) string { return string(a.Attributes.BankIDCode) },
+	"country":         func(a models.Account) string { return string(a.Attributes.Country) },
+	"customer_id":     func(a models.Account) string { return a.Attributes.CustomerID },
+	"iban":            func(a models.Account) string { return a.Attributes.IBAN },
+}
+
+// NewServer - a server for the accounts in store
+func NewServer(store *Store) *Server {
+	return &Server{store: store, rng: rand.New(rand.NewSource(0))}
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == AdminPath {
+		s.admin(w, r)
+		return
+	}
+	if f, ok := s.fault(r); ok {
+		s.inject(w, r, f)
+		return
+	}
+	s.serve(w, r)
+}
+
+func (s *Server) serve(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case r.URL.Path == "/v1/health" && r.Method == http.MethodGet:
+		writeJSON(w, http.StatusOK, map[string]string{"status": "up"})
+	case r.URL.Path == accountsPath:
+		switch r.Method {
+		case http.MethodGet:
+			s.list(w, r)
+		case http.MethodPost:
+			s.create(w, r)
+		default:
+			methodNotAllowed(w, "GET, POST")
+		}
+	case strings.HasPrefix(r.URL.Path, accountsPath+"/"):
+		id := strings.TrimPrefix(r.URL.Path, accountsPath+"/")
+		if !isUUID(id) {
+			writeError(w, http.StatusBadRequest, "id is not a valid uuid")
+			return
+		}
+		switch r.Method {
+		case http.MethodGet:
+			s.fetch(w, id)
+		case http.MethodDelete:
+			s.delete(w, r, id)
+		case http.MethodPatch:
+			s.patch(w, r, id)
+		default:
+			methodNotAllowed(w, "GET, DELETE, PATCH")
+		}
+	default:
+		writeError(w, http.StatusNotFound, fmt.Sprintf("%s not found", r.URL.Path))
+	}
+}
+
+// route - the name faults are configured under for the request
+func route(r *http.Request) string {
+	switch {
+	case r.URL.Path == accountsPath && r.Method == http.MethodGet:
+		return RouteList
+	case r.URL.Path == accountsPath && r.Method == http.MethodPost:
+		return RouteCreate
+	case !strings.HasPrefix(r.URL.Path, accountsPath+"/"):
+		return ""
+	}
+	switch r.Method {
+	case http.MethodGet:
+		return RouteGet
+	case http.MethodDelete:
+		return RouteDelete
+	case http.MethodPatch:
+		return RoutePatch
+	}
+	return ""
+}
+
+func (s *Server) create(w http.ResponseWriter, r *http.Request) {
+	var a models.Account
+	if !decode(w, r, &a) {
+		return
+	}
+	if problems := validate(a); len(problems) > 0 {
+		writeError(w, http.StatusBadRequest, "validation failure list:\n"+strings.Join(problems, "\n"))
+		return
+	}
+
+	now := now()
+	a.CreatedOn, a.ModifiedOn, a.Version = now, now, 0
+	duplicate := false
+	err := s.store.update(func(accounts *[]models.Account) bool {
+		if index(*accounts, a.ID) >= 0 {
+			duplicate = true
+			return false
+		}
+		*accounts = append(*accounts, a)
+		return true
+	})
+	switch {
+	case duplicate:
+		writeError(w, http.StatusConflict, "Account cannot be created as it violates a duplicate constraint")
+	case err != nil:
+		writeError(w, http.StatusInternalServerError, err.Error())
+	default:
+		writeJSON(w, http.StatusCreated, response{Data: a, Links: map[string]string{"self": accountsPath + "/" + a.ID}})
+	}
+}
+
+func (s *Server) fetch(w http.ResponseWriter, id string) {
+	a, ok := s.store.Get(id)
+	if !ok {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("record %s does not exist", id))
+		return
+	}
+	writeJSON(w, http.StatusOK, response{Data: a, Links: map[string]string{"self": accountsPath + "/" + id}})
+}
+
+// list - without page parameters every match is sent, as the client's List
+// expects. Pages are numbered from 0
+func (s *Server) list(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	matches := []models.Account{}
+	for _, a := range s.store.All() {
+		if matchFilters(q, a) {
+			matches = append(matches, a)
+		}
+	}
+
+	_, paged := q["page[number]"]
+	if _, ok := q["page[size]"]; ok {
+		paged = true
+	}
+	if !paged {
+		writeJSON(w, http.StatusOK, response{Data: matches, Links: map[string]string{"self": r.URL.RequestURI()}})
+		return
+	}
+	number, err := queryInt(q, "page[number]", 0)
+	if err != nil || number < 0 {
+		writeError(w, http.StatusBadRequest, "page[number] must be a number greater than or equal to 0")
+		return
+	}
+	size, err := queryInt(q, "page[size]", defaultPageSize)
+	if err != nil || size <= 0 {
+		writeError(w, http.StatusBadRequest, "page[size] must be a number greater than 0")
+		return
+	}
+
+	start, stop := number*size, (number+1)*size
+	if start > len(matches) {
+		start = len(matches)
+	}
+	if stop > len(matches) {
+		stop = len(matches)
+	}
+	last := 0
+	if len(matches) > 0 {
+		last = (len(matches) - 1) / size
+	}
+	links := map[string]string{
+		"self":  pageLink(r.URL, number, size),
+		"first": pageLink(r.URL, 0, size),
+		"last":  pageLink(r.URL, last, size),
+	}
+	if number < last {
+		links["next"] = pageLink(r.URL, number+1, size)
+	}
+	if number > 0 {
+		links["prev"] = pageLink(r.URL, number-1, size)
+	}
+	writeJSON(w, http.StatusOK, response{Data: matches[start:stop], Links: links})
+}
+
+func (s *Server) delete(w http.ResponseWriter, r *http.Request, id string) {
+	version, err := strconv.ParseInt(r.URL.Query().Get("version"), 10, 32)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid version number")
+		return
+	}
+
+	status := http.StatusNoContent
+	err = s.store.update(func(accounts *[]models.Account) bool {
+		i := index(*accounts, id)
+		switch {
+		case i < 0:
+			status = http.StatusNotFound
+			return false
+		case int64((*accounts)[i].Version) != version:
+			status = http.StatusConflict
+			return false
+		}
+		*accounts = append((*accounts)[:i], (*accounts)[i+1:]...)
+		return true
+	})
+	switch {
+	case err != nil:
+		writeError(w, http.StatusInternalServerError, err.Error())
+	case status == http.StatusConflict:
+		writeError(w, status, "invalid version")
+	default:
+		// like the account api, a missing account is a 404 without a body
+		w.WriteHeader(status)
+	}
+}
+
+// patch - merges the attributes sent into the account's. The version sent
+// has to be the account's, it goes up by one
+func (s *Server) patch(w http.ResponseWriter, r *http.Request, id string) {
+	var p patch
+	if !decode(w, r, &p) {
+		return
+	}
+	if len(p.ID) > 0 && p.ID != id {
+		writeError(w, http.StatusBadRequest, "id in body does not match the id in the path")
+		return
+	}
+	if p.Version == nil {
+		writeError(w, http.StatusBadRequest, "validation failure list:\nversion in body is required")
+		return
+	}
+
+	var (
+		status  = http.StatusOK
+		message string
+		patched models.Account
+	)
+	err := s.store.update(func(accounts *[]models.Account) bool {
+		i := index(*accounts, id)
+		if i < 0 {
+			status, message = http.StatusNotFound, fmt.Sprintf("record %s does not exist", id)
+			return false
+		}
+		a := (*accounts)[i]
+		if a.Version != *p.Version {
+			status, message = http.StatusConflict, "invalid version"
+			return false
+		}
+		if len(p.Attributes) > 0 {
+			if err := json.Unmarshal(p.Attributes, &a.Attributes); err != nil {
+				status, message = http.StatusBadRequest, fmt.Sprintf("invalid attributes: %v", err)
+				return false
+			}
+		}
+		a.Version++
+		a.ModifiedOn = now()
+		(*accounts)[i] = a
+		patched = a
+		return true
+	})
+	switch {
+	case err != nil:
+		writeError(w, http.StatusInternalServerError, err.Error())
+	case status != http.StatusOK:
+		writeError(w, status, message)
+	default:
+		writeJSON(w, status, response{Data: patched, Links: map[string]string{"self": accountsPath + "/" + id}})
+	}
+}
+
+// validate - the checks the account api makes on create, worded as it
+// words them
+func validate(a models.Account) []string {
+	var problems []string
+	switch {
+	case len(a.ID) == 0:
+		problems = append(problems, "id in body is required")
+	case !isUUID(a.ID):
+		problems = append(problems, fmt.Sprintf("id in body must be of type uuid: %q", a.ID))
+	}
+	switch {
+	case len(a.OrganisationID) == 0:
+		problems = append(problems, "organisation_id in body is required")
+	case !isUUID(a.OrganisationID):
+		problems = append(problems, fmt.Sprintf("organisation_id in body must be of type uuid: %q", a.OrganisationID))
+	}
+	if a.Type != accountType {
+		problems = append(problems, fmt.Sprintf("type in body should be one of [%s]", accountType))
+	}
+	country := string(a.Attributes.Country)
+	switch {
+	case len(country) == 0:
+		problems = append(problems, "country in body is required")
+	case len(country) != 2 || strings.ToUpper(country) != country:
+		problems = append(problems, fmt.Sprintf("country in body should match '^[A-Z]{2}$': %q", country))
+	}
+	return problems
+}
+
+func matchFilters(q url.Values, a models.Account) bool {
+	for key, values := range q {
+		if !strings.HasPrefix(key, "filter[") || !strings.HasSuffix(key, "]") {
+			continue
+		}
+		get, ok := filters[key[len("filter["):len(key)-1]]
+		if !ok {
+			continue
+		}
+		if !contains(values, get(a)) {
+			return false
+		}
+	}
+	return true
+}
+
+// contains - filter values can be repeated or comma separated, any of them
+// matches
+func contains(values []string, v string) bool {
+	for _, value := range values {
+		for _, want := range strings.Split(value, ",") {
+			if want == v {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func queryInt(q url.Values, key string, def int) (int, error) {
+	v := q.Get(key)
+	if len(v) == 0 {
+		return def, nil
+	}
+	return strconv.Atoi(v)
+}
+
+func pageLink(u *url.URL, number, size int) string {
+	q := u.Query()
+	q.Set("page[number]", strconv.Itoa(number))
+	q.Set("page[size]", strconv.Itoa(size))
+	return u.Path + "?" + q.Encode()
+}
+
+// decode - reads the data of the request body into v, answering with a 400
+// when it can't
+func decode(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	var req request
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid request body: %v", err))
+		return false
+	}
+	if len(req.Data) == 0 || string(req.Data) == "null" {
+		writeError(w, http.StatusBadRequest, "validation failure list:\ndata in body is required")
+		return false
+	}
+	if err := json.Unmarshal(req.Data, v); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid request body: %v", err))
+		return false
+	}
+	return true
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/vnd.api+json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, errorResponse{ErrorMessage: message})
+}
+
+func methodNotAllowed(w http.ResponseWriter, allow string) {
+	w.Header().Set("Allow", allow)
+	writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+}
+
+// now - timestamps are kept to the millisecond, as the account api sends them
+func now() models.Timestamp {
+	return models.Timestamp{Time: time.Now().UTC().Truncate(time.Millisecond)}
+}
+
+func isUUID(id string) bool {
+	_, err := uuid.Parse(id)
+	return err == nil && len(id) == 36
+}
@@ -0,0 +1,266 @@
+package fakeapi
+
+import (
+	"account"
+	"account/infrastructure"
+	"account/models"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestServerServesTheAccountService(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fakeapi")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "accounts.json")
+	store, err := OpenStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	s := httptest.NewServer(NewServer(store))
+	defer s.Close()
+	u, _ := url.Parse(s.URL)
+	service := account.NewService(infrastructure.NewHTTP(ctx, s.Client(), u, ""))
+
+	ids := []string{
+		"ad27e265-9605-4b4b-a0e5-3003ea9cc4dc",
+		"bd27e265-9605-4b4b-a0e5-3003ea9cc4dc",
+		"cd27e265-9605-4b4b-a0e5-3003ea9cc4dc",
+	}
+	for i, id := range ids {
+		a, err := account.NewGB().ID(id).OrganisationID("eb0bd6f5-c3f5-44b2-b677-acd23cdde73c").
+			BankID("400302").AccountNumber("1000000" + string(rune('4'+i))).Bic("NWBKGB42").Build()
+		if err != nil {
+			t.Fatal(err)
+		}
+		created, err := service.Create(a)
+		if err != nil {
+			t.Fatalf("Create failed with error: %v", err)
+		}
+		if created.CreatedOn.IsZero() || created.Version != 0 {
+			t.Errorf("Create returned %+v, expected created_on to be set and version 0", created)
+		}
+	}
+
+	a, _ := service.GetByID(ids[0])
+	if _, err := service.Create(*a); !account.IsDuplicate(err) {
+		t.Errorf("Create of an existing account returned %v, expected a duplicate", err)
+	}
+	if _, err := service.GetByID("538fd1a0-b62d-4b56-beb8-7836a1fedd2e"); err == nil || !strings.Contains(err.Error(), "does not exist") {
+		t.Errorf("GetByID of a missing account returned %v", err)
+	}
+
+	var walked []string
+	err = service.Walk(2, func(a models.Account) error {
+		walked = append(walked, a.ID)
+		return nil
+	})
+	if err != nil || strings.Join(walked, ",") != strings.Join(ids, ",") {
+		t.Errorf("Walk returned %v, %v, expected %v", walked, err, ids)
+	}
+	accounts, err := service.List(2, 2)
+	if err != nil || len(accounts) != 1 || accounts[0].ID != ids[2] {
+		t.Errorf("List(2, 2) returned %+v, %v", accounts, err)
+	}
+
+	res := do(t, s, http.MethodGet, "/v1/organisation/accounts?filter[account_number]=10000005", "")
+	if res.status != http.StatusOK || !strings.Contains(res.body, ids[1]) || strings.Contains(res.body, ids[0]) {
+		t.Errorf("filtered list returned %d %s", res.status, res.body)
+	}
+	res = do(t, s, http.MethodPost, "/v1/organisation/accounts", `{"data":{"id":"da968913","type":"accounts","attributes":{}}}`)
+	if res.status != http.StatusBadRequest || !strings.Contains(res.body, `"error_message":"validation failure list:`) {
+		t.Errorf("invalid create returned %d %s", res.status, res.body)
+	}
+
+	res = do(t, s, http.MethodPatch, "/v1/organisation/accounts/"+ids[1], `{"data":{"version":0,"attributes":{"customer_id":"c-1"}}}`)
+	if res.status != http.StatusOK || !strings.Contains(res.body, `"version":1`) || !strings.Contains(res.body, `"customer_id":"c-1"`) || !strings.Contains(res.body, `"bank_id":"400302"`) {
+		t.Errorf("patch returned %d %s", res.status, res.body)
+	}
+	res = do(t, s, http.MethodPatch, "/v1/organisation/accounts/"+ids[1], `{"data":{"version":0,"attributes":{"customer_id":"c-2"}}}`)
+	if res.status != http.StatusConflict {
+		t.Errorf("patch of an old version returned %d %s", res.status, res.body)
+	}
+	res = do(t, s, http.MethodDelete, "/v1/organisation/accounts/"+ids[1]+"?version=0", "")
+	if res.status != http.StatusConflict || !strings.Contains(res.body, "invalid version") {
+		t.Errorf("delete of an old version returned %d %s", res.status, res.body)
+	}
+	if err := service.DeleteByID(ids[0]); err != nil {
+		t.Errorf("DeleteByID failed with error: %v", err)
+	}
+	res = do(t, s, http.MethodDelete, "/v1/organisation/accounts/"+ids[0]+"?version=0", "")
+	if res.status != http.StatusNotFound {
+		t.Errorf("delete of a missing account returned %d %s", res.status, res.body)
+	}
+
+	// everything but the deleted account survives a restart
+	reopened, err := OpenStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	all := reopened.All()
+	if len(all) != 2 || all[0].ID != ids[1] || all[0].Version != 1 || all[0].Attributes.CustomerID != "c-1" {
+		t.Errorf("reopened store has %+v", all)
+	}
+}
+
+func TestStoreKeepsAccountsWhenSaveFails(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fakeapi")
+	if err != nil {
+		t.Fatal(err)
+	}
+	store, err := OpenStore(filepath.Join(dir, "accounts.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.RemoveAll(dir)
+
+	err = store.update(func(accounts *[]models.Account) bool {
+		*accounts = append(*accounts, models.Account{ID: "ad27e265-9605-4b4b-a0e5-3003ea9cc4dc"})
+		return true
+	})
+	if err == nil || len(store.All()) != 0 {
+		t.Errorf("update with a failing save returned %v and left %+v, expected an error and no accounts", err, store.All())
+	}
+}
+
+func TestFaultsAdmin(t *testing.T) {
+	server := NewServer(NewStore())
+	s := httptest.NewServer(server)
+	defer s.Close()
+
+	res := do(t, s, http.MethodPut, AdminPath, `{"seed":1,"routes":{"get":{"server_error":0.6,"reset":0.6}}}`)
+	if res.status != http.StatusBadRequest || !strings.Contains(res.body, "more than 1") {
+		t.Errorf("PUT of impossible faults returned %d %s", res.status, res.body)
+	}
+	res = do(t, s, http.MethodPut, AdminPath, `{"seed":1,"routes":{"*":{"latency":0.5,"delay":"5ms","too_many_requests":1,"retry_after":7}}}`)
+	if res.status != http.StatusOK || server.Faults().Routes[RouteAll].Delay != Duration(5*time.Millisecond) {
+		t.Errorf("PUT of faults returned %d %s, server has %+v", res.status, res.body, server.Faults())
+	}
+	req, _ := http.NewRequest(http.MethodGet, s.URL+"/v1/organisation/accounts", nil)
+	resp, err := s.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusTooManyRequests || resp.Header.Get("Retry-After") != "7" {
+		t.Errorf("faulted list returned %d with Retry-After %q", resp.StatusCode, resp.Header.Get("Retry-After"))
+	}
+
+	res = do(t, s, http.MethodGet, AdminPath, "")
+	if res.status != http.StatusOK || !strings.Contains(res.body, `"delay":"5ms"`) {
+		t.Errorf("GET of faults returned %d %s", res.status, res.body)
+	}
+	res = do(t, s, http.MethodDelete, AdminPath, "")
+	if res.status != http.StatusOK || len(server.Faults().Routes) != 0 {
+		t.Errorf("DELETE of faults returned %d %s", res.status, res.body)
+	}
+	if res := do(t, s, http.MethodGet, "/v1/organisation/accounts", ""); res.status != http.StatusOK {
+		t.Errorf("list after clearing faults returned %d %s", res.status, res.body)
+	}
+}
+
+func TestFaultsFailTheService(t *testing.T) {
+	server := NewServer(NewStore())
+	s := httptest.NewServer(server)
+	defer s.Close()
+	u, _ := url.Parse(s.URL)
+	service := account.NewService(infrastructure.NewHTTP(context.Background(), s.Client(), u, ""))
+
+	id := "ad27e265-9605-4b4b-a0e5-3003ea9cc4dc"
+	a, err := account.NewGB().ID(id).OrganisationID("eb0bd6f5-c3f5-44b2-b677-acd23cdde73c").
+		BankID("400302").AccountNumber("10000004").Bic("NWBKGB42").Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := service.Create(a); err != nil {
+		t.Fatalf("Create failed with error: %v", err)
+	}
+
+	// the same seed fails the same requests
+	outcomes := func() string {
+		server.SetFaults(Faults{Seed: 42, Routes: map[string]Fault{RouteGet: {ServerError: 0.5}}})
+		var b strings.Builder
+		for i := 0; i < 20; i++ {
+			if _, err := service.GetByID(id); err != nil {
+				b.WriteByte('x')
+			} else {
+				b.WriteByte('.')
+			}
+		}
+		return b.String()
+	}
+	first := outcomes()
+	if second := outcomes(); first != second || !strings.Contains(first, "x") || !strings.Contains(first, ".") {
+		t.Errorf("seeded faults failed %s then %s, expected the same mix of failures", first, second)
+	}
+
+	for _, tc := range []struct {
+		name  string
+		fault Fault
+		check func(err error) bool
+	}{
+		{"server error", Fault{ServerError: 1, Status: http.StatusBadGateway}, func(err error) bool {
+			var apiErr *infrastructure.APIError
+			return errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusBadGateway
+		}},
+		{"too many requests", Fault{TooManyRequests: 1}, func(err error) bool {
+			var apiErr *infrastructure.APIError
+			return errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusTooManyRequests
+		}},
+		{"reset", Fault{Reset: 1}, func(err error) bool {
+			var urlErr *url.Error
+			return errors.As(err, &urlErr)
+		}},
+		{"truncate", Fault{Truncate: 1}, func(err error) bool {
+			return errors.Is(err, io.ErrUnexpectedEOF)
+		}},
+		{"malformed", Fault{Malformed: 1}, func(err error) bool {
+			var syntaxErr *json.SyntaxError
+			return errors.As(err, &syntaxErr)
+		}},
+		{"latency", Fault{Latency: 1, Delay: Duration(time.Second)}, func(err error) bool {
+			return errors.Is(err, context.DeadlineExceeded)
+		}},
+	} {
+		server.SetFaults(Faults{Routes: map[string]Fault{RouteAll: tc.fault}})
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		_, err := service.GetByIDContext(ctx, id)
+		cancel()
+		if !tc.check(err) {
+			t.Errorf("GetByID with %s injected returned %v", tc.name, err)
+		}
+	}
+}
+
+type result struct {
+	status int
+	body   string
+}
+
+func do(t *testing.T, s *httptest.Server, method, path, body string) result {
+	t.Helper()
+	req, _ := http.NewRequest(method, s.URL+path, strings.NewReader(body))
+	resp, err := s.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	b, _ := ioutil.ReadAll(resp.Body)
+	return result{status: resp.StatusCode, body: string(b)}
+}
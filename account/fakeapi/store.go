@@ -0,0 +1,93 @@
+package fakeapi
+
+import (
+	"account/internal/atomicfile"
+	"account/models"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"sync"
+)
+
+// Store - the accounts the fake holds, in the order they were created. With
+// a path every change is written to a json file and loaded back on start
+type Store struct {
+	mu       sync.Mutex
+	path     string
+	accounts []models.Account
+}
+
+// NewStore - a store kept in memory only
+func NewStore() *Store {
+	return &Store{}
+}
+
+// OpenStore - a store persisted to the json file at path, loading the
+// accounts already in it
+func OpenStore(path string) (*Store, error) {
+	s := &Store{path: path}
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return s, json.Unmarshal(b, &s.accounts)
+}
+
+// All - a copy of every account
+func (s *Store) All() []models.Account {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]models.Account(nil), s.accounts...)
+}
+
+// Get - the account with id
+func (s *Store) Get(id string) (models.Account, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i := index(s.accounts, id)
+	if i < 0 {
+		return models.Account{}, false
+	}
+	return s.accounts[i], true
+}
+
+// update - runs fn with a copy of the accounts under the lock. When fn
+// returns true the copy replaces the accounts, once it's saved, so a failed
+// save leaves the store as it was
+func (s *Store) update(fn func(accounts *[]models.Account) bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	accounts := append([]models.Account(nil), s.accounts...)
+	if !fn(&accounts) {
+		return nil
+	}
+	if len(s.path) > 0 {
+		if err := s.save(accounts); err != nil {
+			return err
+		}
+	}
+	s.accounts = accounts
+	return nil
+}
+
+// index - where the account with id is in accounts, -1 when it isn't
+func index(accounts []models.Account, id string) int {
+	for i, a := range accounts {
+		if a.ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// save - replaces the file in one go so a crash never leaves half of it
+func (s *Store) save(accounts []models.Account) error {
+	b, err := json.MarshalIndent(accounts, "", "  ")
+	if err != nil {
+		return err
+	}
+	return atomicfile.Write(s.path, b)
+}
@@ -0,0 +1,221 @@
+// Package fixture - generates valid, randomised accounts for tests. Every
+// account passes account.Validate, has the bank id format of its country
+// and, where package iban knows the country, an IBAN with correct check
+// digits. A Factory made with the same seed generates the same accounts
+package fixture
+
+import (
+	"account"
+	"account/iban"
+	"account/models"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	accountsPath = "/v1/organisation/accounts"
+	letters      = "ABCDEFGHIJKLMNOPQRSTUVWXYZ"
+	alphanumeric = letters + "0123456789"
+)
+
+type (
+	// Factory - generates accounts from a seeded random source. It isn't
+	// safe for concurrent use, give each goroutine its own
+	Factory struct {
+		rng *rand.Rand
+		// OrganisationID - the organisation of the accounts generated, a
+		// random one for each account when empty
+		OrganisationID string
+	}
+
+	// format - how a country's bank id and account number look, within
+	// what both account.Validate and iban.Generate accept
+	format struct {
+		bankID  func(r *rand.Rand) string
+		account [2]int
+	}
+
+	response struct {
+		Data  interface{}       `json:"data"`
+		Links map[string]string `json:"links"`
+	}
+)
+
+// epoch - created_on of the generated accounts is within a year of it
+var epoch = time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+var formats = map[models.Country]format{
+	models.CountryAU: {bankID: digits(6), account: [2]int{6, 10}},
+	models.CountryBE: {bankID: digits(3), account: [2]int{7, 7}},
+	models.CountryCA: {bankID: canadianPaymentsCode, account: [2]int{7, 12}},
+	models.CountryCH: {bankID: digits(5), account: [2]int{12, 12}},
+	models.CountryDE: {bankID: digits(8), account: [2]int{10, 10}},
+	models.CountryES: {bankID: digits(8), account: [2]int{10, 10}},
+	models.CountryFR: {bankID: digits(10), account: [2]int{11, 11}},
+	models.CountryGB: {bankID: digits(6), account: [2]int{8, 8}},
+	models.CountryGR: {bankID: digits(7), account: [2]int{16, 16}},
+	models.CountryHK: {bankID: digits(3), account: [2]int{9, 12}},
+	models.CountryIT: {bankID: digits(10), account: [2]int{12, 12}},
+	models.CountryLU: {bankID: digits(3), account: [2]int{13, 13}},
+	models.CountryNL: {account: [2]int{10, 10}},
+	models.CountryPL: {bankID: digits(8), account: [2]int{16, 16}},
+	models.CountryPT: {bankID: digits(8), account: [2]int{11, 11}},
+	models.CountryUS: {bankID: abaRoutingNumber, account: [2]int{6, 17}},
+}
+
+// abaSymbols - the ranges the first two digits of a routing number are in
+var abaSymbols = [][2]int{{1, 12}, {21, 32}, {61, 72}, {80, 80}}
+
+var names = []string{"Samantha Holder", "Jo Bloggs", "Alex Smith", "Ada Lovelace", "Sam Jones", "Chris Taylor"}
+
+// New - a factory generating from seed
+func New(seed int64) *Factory {
+	return &Factory{rng: rand.New(rand.NewSource(seed))}
+}
+
+// Countries - the countries accounts can be generated for, sorted
+func Countries() []models.Country {
+	countries := make([]models.Country, 0, len(formats))
+	for c := range formats {
+		countries = append(countries, c)
+	}
+	sort.Slice(countries, func(i, j int) bool { return countries[i] < countries[j] })
+	return countries
+}
+
+// Account - a valid account in country, as the account api would hold it
+// after creating it. Panics for countries not in Countries
+func (f *Factory) Account(country models.Country) models.Account {
+	fm, ok := formats[country]
+	if !ok {
+		panic(fmt.Sprintf("fixture: can't generate %s accounts", country))
+	}
+
+	b := account.NewBuilder(country).
+		ID(f.UUID()).
+		OrganisationID(f.organisationID()).
+		Classification(f.classification()).
+		AccountNumber(digits(fm.account[0] + f.rng.Intn(fm.account[1]-fm.account[0]+1))(f.rng)).
+		Bic(f.bic(country)).
+		CustomerID(digits(8)(f.rng))
+	if fm.bankID != nil {
+		b.BankID(fm.bankID(f.rng))
+	}
+	if f.rng.Intn(2) == 0 {
+		b.AlternativeBankAccountNames(names[f.rng.Intn(len(names))])
+	}
+	a, err := b.Build()
+	if err != nil {
+		panic(fmt.Sprintf("fixture: generated an invalid account: %v", err))
+	}
+
+	a.Attributes.IBAN, err = iban.Generate(a.Attributes)
+	if err != nil && !errors.Is(err, iban.ErrUnsupported) {
+		panic(fmt.Sprintf("fixture: generated an account without an iban: %v", err))
+	}
+	created := epoch.Add(time.Duration(f.rng.Int63n(int64(365*24*time.Hour/time.Millisecond))) * time.Millisecond)
+	// parsed as though the account api sent it, so it matches the account
+	// decoded from Response
+	a.CreatedOn, _ = models.ParseTimestamp(created.Format(models.TimestampLayout))
+	a.ModifiedOn = a.CreatedOn
+	return a
+}
+
+// Accounts - n accounts, each in a random one of countries or of all of
+// Countries when none are given
+func (f *Factory) Accounts(n int, countries ...models.Country) []models.Account {
+	if len(countries) == 0 {
+		countries = Countries()
+	}
+	accounts := make([]models.Account, n)
+	for i := range accounts {
+		accounts[i] = f.Account(countries[f.rng.Intn(len(countries))])
+	}
+	return accounts
+}
+
+// UUID - a random version 4 uuid from the factory's source
+func (f *Factory) UUID() string {
+	var id uuid.UUID
+	f.rng.Read(id[:])
+	id[6] = id[6]&0x0f | 0x40 // version 4
+	id[8] = id[8]&0x3f | 0x80 // RFC 4122 variant
+	return id.String()
+}
+
+// Response - a as the account api sends it from fetch or create
+func Response(a models.Account) ([]byte, error) {
+	return json.Marshal(response{Data: a, Links: map[string]string{"self": accountsPath + "/" + a.ID}})
+}
+
+// ListResponse - accounts as the account api sends them from list
+func ListResponse(accounts []models.Account) ([]byte, error) {
+	if accounts == nil {
+		accounts = []models.Account{}
+	}
+	return json.Marshal(response{Data: accounts, Links: map[string]string{"self": accountsPath}})
+}
+
+func (f *Factory) organisationID() string {
+	if len(f.OrganisationID) > 0 {
+		return f.OrganisationID
+	}
+	return f.UUID()
+}
+
+func (f *Factory) classification() models.Classification {
+	if f.rng.Intn(2) == 0 {
+		return models.ClassificationPersonal
+	}
+	return models.ClassificationBusiness
+}
+
+// bic - a SWIFT BIC of a made up bank in country: four letter bank code,
+// the country and a two character location, sometimes with a branch
+func (f *Factory) bic(country models.Country) string {
+	bic := pick(f.rng, letters, 4) + string(country) + pick(f.rng, alphanumeric, 2)
+	if f.rng.Intn(4) == 0 {
+		bic += pick(f.rng, alphanumeric, 3)
+	}
+	return bic
+}
+
+func digits(n int) func(r *rand.Rand) string {
+	return func(r *rand.Rand) string {
+		return pick(r, "0123456789", n)
+	}
+}
+
+func pick(r *rand.Rand, from string, n int) string {
+	var sb strings.Builder
+	for i := 0; i < n; i++ {
+		sb.WriteByte(from[r.Intn(len(from))])
+	}
+	return sb.String()
+}
+
+// canadianPaymentsCode - 0, a three digit institution number and a five
+// digit transit number
+func canadianPaymentsCode(r *rand.Rand) string {
+	return "0" + digits(8)(r)
+}
+
+// abaRoutingNumber - nine digits starting with a Federal Reserve routing
+// symbol, whose 3-7-1 weighted sum is a multiple of 10
+func abaRoutingNumber(r *rand.Rand) string {
+	symbols := abaSymbols[r.Intn(len(abaSymbols))]
+	d := fmt.Sprintf("%02d", symbols[0]+r.Intn(symbols[1]-symbols[0]+1)) + digits(6)(r)
+	weights := []int{3, 7, 1, 3, 7, 1, 3, 7}
+	sum := 0
+	for i, c := range d {
+		sum += int(c-'0') * weights[i]
+	}
+	return d + fmt.Sprint((10-sum%10)%10)
+}
@@ -0,0 +1,116 @@
+package fixture
+
+import (
+	"account"
+	"account/iban"
+	"account/infrastructure"
+	"account/models"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestFactoryGeneratesValidAccounts(t *testing.T) {
+	f := New(1)
+	for _, country := range Countries() {
+		for i := 0; i < 50; i++ {
+			a := f.Account(country)
+			if err := account.Validate(a); err != nil {
+				t.Fatalf("generated an invalid account: %v", err)
+			}
+			_, supported := ibanCountries[country]
+			switch {
+			case supported && !iban.Valid(a.Attributes.IBAN):
+				t.Fatalf("generated %s account %+v with an invalid iban", country, a.Attributes)
+			case !supported && len(a.Attributes.IBAN) > 0:
+				t.Fatalf("generated %s account with an iban %s", country, a.Attributes.IBAN)
+			}
+			if supported {
+				parsed, err := iban.Parse(a.Attributes.IBAN)
+				if err != nil || parsed.BankID != a.Attributes.BankID || parsed.AccountNumber != a.Attributes.AccountNumber {
+					t.Fatalf("iban %s of %s account parsed to %+v, %v", a.Attributes.IBAN, country, parsed, err)
+				}
+				parsed.Bic = a.Attributes.Bic
+				if err := account.Validate(models.Account{Attributes: parsed}); err != nil {
+					t.Fatalf("iban %s of %s account parsed to invalid attributes: %v", a.Attributes.IBAN, country, err)
+				}
+			}
+			if country == models.CountryUS && !validRoutingNumber(a.Attributes.BankID) {
+				t.Fatalf("generated an invalid routing number %s", a.Attributes.BankID)
+			}
+		}
+	}
+}
+
+func TestFactoryIsSeeded(t *testing.T) {
+	first, second := New(7).Accounts(20), New(7).Accounts(20)
+	if !reflect.DeepEqual(first, second) {
+		t.Error("the same seed generated different accounts")
+	}
+	if reflect.DeepEqual(first, New(8).Accounts(20)) {
+		t.Error("different seeds generated the same accounts")
+	}
+
+	if id, err := uuid.Parse(New(7).UUID()); err != nil || id.Version() != 4 || id.Variant() != uuid.RFC4122 {
+		t.Errorf("UUID returned %v, %v, expected a version 4 uuid", id, err)
+	}
+
+	f := New(7)
+	f.OrganisationID = "eb0bd6f5-c3f5-44b2-b677-acd23cdde73c"
+	for _, a := range f.Accounts(5, models.CountryGB, models.CountryDE) {
+		if a.OrganisationID != f.OrganisationID || a.Attributes.Country != models.CountryGB && a.Attributes.Country != models.CountryDE {
+			t.Errorf("generated %+v, expected a GB or DE account in the organisation", a)
+		}
+	}
+}
+
+func TestResponsesDecodeThroughTheService(t *testing.T) {
+	f := New(3)
+	accounts := f.Accounts(3)
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var b []byte
+		if r.URL.Path == accountsPath {
+			b, _ = ListResponse(accounts)
+		} else {
+			b, _ = Response(accounts[0])
+		}
+		w.Write(b)
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	s := httptest.NewServer(h)
+	defer s.Close()
+	u, _ := url.Parse(s.URL)
+	service := account.NewService(infrastructure.NewHTTP(ctx, s.Client(), u, ""))
+
+	got, err := service.GetByID(accounts[0].ID)
+	if err != nil || !reflect.DeepEqual(*got, accounts[0]) {
+		t.Errorf("GetByID returned %+v, %v, expected %+v", got, err, accounts[0])
+	}
+	list, err := service.List(1, 10)
+	if err != nil || !reflect.DeepEqual(list, accounts) {
+		t.Errorf("List returned %+v, %v, expected %+v", list, err, accounts)
+	}
+}
+
+// ibanCountries - the countries package iban generates IBANs for
+var ibanCountries = map[models.Country]bool{
+	models.CountryBE: true, models.CountryCH: true, models.CountryDE: true, models.CountryES: true,
+	models.CountryFR: true, models.CountryGB: true, models.CountryGR: true, models.CountryIT: true,
+	models.CountryLU: true, models.CountryNL: true, models.CountryPL: true, models.CountryPT: true,
+}
+
+func validRoutingNumber(n string) bool {
+	weights := []int{3, 7, 1, 3, 7, 1, 3, 7, 1}
+	sum := 0
+	for i, c := range n {
+		sum += int(c-'0') * weights[i]
+	}
+	return len(n) == 9 && sum%10 == 0
+}
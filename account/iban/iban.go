@@ -0,0 +1,262 @@
+// Package iban - derives IBANs from the bank id and account number of an
+// account and splits them back up. The BBAN is put together the way each
+// country structures it, with any national check digits it carries
+package iban
+
+import (
+	"account/models"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// parts of a BBAN, in the order they appear for each country
+const (
+	bankCode = iota // first four letters of the bic
+	bankID
+	account
+	check
+)
+
+var (
+	// ErrUnsupported - the country's BBAN structure isn't known
+	ErrUnsupported = errors.New("country isn't supported")
+
+	// ErrChecksum - the IBAN's check digits are wrong
+	ErrChecksum = errors.New("iban check digits are wrong")
+)
+
+// format - how a country's BBAN is laid out
+type format struct {
+	bankIDCode models.BankIDCode
+	layout     []int
+	bankID     int
+	account    int
+	// check - the national check digits, given the bank id and account
+	check func(bankID, account string) string
+}
+
+var formats = map[models.Country]format{
+	models.CountryBE: {bankIDCode: models.BankIDCodeBE, layout: []int{bankID, account, check}, bankID: 3, account: 7, check: belgianCheck},
+	models.CountryCH: {bankIDCode: models.BankIDCodeCHBCC, layout: []int{bankID, account}, bankID: 5, account: 12},
+	models.CountryDE: {bankIDCode: models.BankIDCodeDEBLZ, layout: []int{bankID, account}, bankID: 8, account: 10},
+	models.CountryES: {bankIDCode: models.BankIDCodeESNCC, layout: []int{bankID, check, account}, bankID: 8, account: 10, check: spanishCheck},
+	models.CountryFR: {bankIDCode: models.BankIDCodeFR, layout: []int{bankID, account, check}, bankID: 10, account: 11, check: ribKey},
+	models.CountryGB: {bankIDCode: models.BankIDCodeGBDSC, layout: []int{bankCode, bankID, account}, bankID: 6, account: 8},
+	models.CountryGR: {bankIDCode: models.BankIDCodeGRBIC, layout: []int{bankID, account}, bankID: 7, account: 16},
+	models.CountryIT: {bankIDCode: models.BankIDCodeITNCC, layout: []int{check, bankID, account}, bankID: 10, account: 12, check: italianCIN},
+	models.CountryLU: {bankIDCode: models.BankIDCodeLULUX, layout: []int{bankID, account}, bankID: 3, account: 13},
+	models.CountryNL: {layout: []int{bankCode, account}, account: 10},
+	models.CountryPL: {bankIDCode: models.BankIDCodePLKNR, layout: []int{bankID, account}, bankID: 8, account: 16},
+	models.CountryPT: {bankIDCode: models.BankIDCodePTNCC, layout: []int{bankID, account, check}, bankID: 8, account: 11, check: portugueseCheck},
+}
+
+// Generate - the IBAN for the country, bank id and account number in attr.
+// GB and NL IBANs start with the bank code, taken from attr.Bic. Account
+// numbers shorter than the BBAN field are padded with leading zeros
+func Generate(attr models.Attributes) (string, error) {
+	f, ok := formats[attr.Country]
+	if !ok {
+		return "", fmt.Errorf("%s: %w", attr.Country, ErrUnsupported)
+	}
+
+	bank := Normalise(attr.BankID)
+	acc := Normalise(attr.AccountNumber)
+	if len(bank) != f.bankID {
+		return "", fmt.Errorf("%s bank id %q should be %d characters", attr.Country, attr.BankID, f.bankID)
+	}
+	if len(acc) == 0 || len(acc) > f.account {
+		return "", fmt.Errorf("%s account number %q should be up to %d characters", attr.Country, attr.AccountNumber, f.account)
+	}
+	if _, ok := numeric(bank + acc); !ok {
+		return "", fmt.Errorf("%s bank id and account number should only contain letters and digits", attr.Country)
+	}
+	acc = strings.Repeat("0", f.account-len(acc)) + acc
+
+	var bban strings.Builder
+	for _, part := range f.layout {
+		switch part {
+		case bankCode:
+			bic := Normalise(attr.Bic)
+			if len(bic) < 4 {
+				return "", fmt.Errorf("%s iban needs the bank code from the bic", attr.Country)
+			}
+			bban.WriteString(bic[:4])
+		case bankID:
+			bban.WriteString(bank)
+		case account:
+			bban.WriteString(acc)
+		case check:
+			bban.WriteString(f.check(bank, acc))
+		}
+	}
+
+	country := string(attr.Country)
+	return country + checkDigits(country, bban.String()) + bban.String(), nil
+}
+
+// Parse - splits a valid IBAN into the country, bank id code, bank id and
+// account number of an account, with the IBAN normalised. National check
+// digits are dropped, so account numbers come back at their full length
+func Parse(s string) (models.Attributes, error) {
+	s = Normalise(s)
+	if !Valid(s) {
+		return models.Attributes{}, ErrChecksum
+	}
+
+	country := models.Country(s[:2])
+	f, ok := formats[country]
+	if !ok {
+		return models.Attributes{}, fmt.Errorf("%s: %w", country, ErrUnsupported)
+	}
+
+	attr := models.Attributes{Country: country, BankIDCode: f.bankIDCode, IBAN: s}
+	bban := s[4:]
+	for _, part := range f.layout {
+		n := f.length(part)
+		if len(bban) < n {
+			return models.Attributes{}, fmt.Errorf("%s iban should be %d characters", country, f.length(-1)+4)
+		}
+		switch part {
+		case bankID:
+			attr.BankID = bban[:n]
+		case account:
+			attr.AccountNumber = bban[:n]
+		}
+		bban = bban[n:]
+	}
+	if len(bban) > 0 {
+		return models.Attributes{}, fmt.Errorf("%s iban should be %d characters", country, f.length(-1)+4)
+	}
+	return attr, nil
+}
+
+// Valid - whether s, once normalised, has the right check digits
+func Valid(s string) bool {
+	s = Normalise(s)
+	if len(s) < 5 || len(s) > 34 {
+		return false
+	}
+	n, ok := numeric(s[4:] + s[:4])
+	return ok && mod97(n) == 1
+}
+
+// Normalise - upper case without spaces, the electronic IBAN format
+func Normalise(s string) string {
+	return strings.ToUpper(strings.Join(strings.Fields(s), ""))
+}
+
+// length - the length of a part of the BBAN, or of all of it for -1
+func (f format) length(part int) int {
+	switch part {
+	case bankCode:
+		return 4
+	case bankID:
+		return f.bankID
+	case account:
+		return f.account
+	case check:
+		return len(f.check(strings.Repeat("0", f.bankID), strings.Repeat("0", f.account)))
+	}
+	total := 0
+	for _, p := range f.layout {
+		total += f.length(p)
+	}
+	return total
+}
+
+func checkDigits(country, bban string) string {
+	n, _ := numeric(bban + country + "00")
+	return fmt.Sprintf("%02d", 98-mod97(n))
+}
+
+// numeric - s with letters replaced by 10 to 35
+func numeric(s string) (string, bool) {
+	var sb strings.Builder
+	for _, r := range s {
+		switch {
+		case r >= '0' && r <= '9':
+			sb.WriteRune(r)
+		case r >= 'A' && r <= 'Z':
+			fmt.Fprint(&sb, int(r-'A')+10)
+		default:
+			return "", false
+		}
+	}
+	return sb.String(), true
+}
+
+func mod97(digits string) int {
+	n, _ := new(big.Int).SetString(digits, 10)
+	return int(new(big.Int).Mod(n, big.NewInt(97)).Int64())
+}
+
+func belgianCheck(bankID, account string) string {
+	n, _ := numeric(bankID + account)
+	check := mod97(n)
+	if check == 0 {
+		check = 97
+	}
+	return fmt.Sprintf("%02d", check)
+}
+
+func spanishCheck(bankID, account string) string {
+	digit := func(s string) int {
+		weights := []int{1, 2, 4, 8, 5, 10, 9, 7, 3, 6}
+		total := 0
+		for i, r := range s {
+			total += int(r-'0') * weights[i]
+		}
+		d := 11 - total%11
+		switch d {
+		case 11:
+			return 0
+		case 10:
+			return 1
+		}
+		return d
+	}
+	return fmt.Sprintf("%d%d", digit("00"+bankID), digit(account))
+}
+
+func ribKey(bankID, account string) string {
+	// letters in french account numbers count as digits, A-I and J-R are 1-9
+	// and S-Z are 2-9
+	digits := strings.Map(func(r rune) rune {
+		if r >= 'A' && r <= 'Z' {
+			return rune("12345678912345678923456789"[r-'A'])
+		}
+		return r
+	}, bankID+account)
+	bank, _ := new(big.Int).SetString(digits[:5], 10)
+	branch, _ := new(big.Int).SetString(digits[5:10], 10)
+	acc, _ := new(big.Int).SetString(digits[10:], 10)
+
+	total := new(big.Int).Mul(bank, big.NewInt(89))
+	total.Add(total, new(big.Int).Mul(branch, big.NewInt(15)))
+	total.Add(total, new(big.Int).Mul(acc, big.NewInt(3)))
+	return fmt.Sprintf("%02d", 97-new(big.Int).Mod(total, big.NewInt(97)).Int64())
+}
+
+func italianCIN(bankID, account string) string {
+	odd := []int{1, 0, 5, 7, 9, 13, 15, 17, 19, 21, 2, 4, 18, 20, 11, 3, 6, 8, 12, 14, 16, 10, 22, 25, 24, 23}
+	total := 0
+	for i, r := range bankID + account {
+		v := int(r - '0')
+		if r >= 'A' && r <= 'Z' {
+			v = int(r - 'A')
+		}
+		if i%2 == 0 {
+			total += odd[v]
+		} else {
+			total += v
+		}
+	}
+	return string(rune('A' + total%26))
+}
+
+func portugueseCheck(bankID, account string) string {
+	n, _ := numeric(bankID + account + "00")
+	return fmt.Sprintf("%02d", 98-mod97(n))
+}
@@ -0,0 +1,53 @@
+package iban
+
+import (
+	"account/models"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestIBANGenerateAndParse(t *testing.T) {
+	t.Parallel()
+	for _, want := range []string{
+		"BE68539007547034",
+		"CH9300762011623852957",
+		"DE89370400440532013000",
+		"ES9121000418450200051332",
+		"FR1420041010050500013M02606",
+		"GB29NWBK60161331926819",
+		"GR1601101250000000012300695",
+		"IT60X0542811101000000123456",
+		"LU280019400644750000",
+		"NL91ABNA0417164300",
+		"PL61109010140000071219812874",
+		"PT50000201231234567890154",
+	} {
+		attr, err := Parse(want[:4] + " " + strings.ToLower(want[4:]))
+		if err != nil {
+			t.Errorf("Parse(%s) failed with error: %v", want, err)
+			continue
+		}
+		attr.Bic = want[4:8] + "XXXX"
+		got, err := Generate(attr)
+		if err != nil || got != want {
+			t.Errorf("Generate(%+v) returned %s, %v, expected %s", attr, got, err, want)
+		}
+	}
+
+	attr, _ := Parse("GB29 NWBK 6016 1331 9268 19")
+	if attr.Country != models.CountryGB || attr.BankIDCode != models.BankIDCodeGBDSC || attr.BankID != "601613" || attr.AccountNumber != "31926819" {
+		t.Errorf("Parse returned %+v, expected GB sort code 601613 and account number 31926819", attr)
+	}
+
+	de, err := Generate(models.Attributes{Country: models.CountryDE, BankID: "37040044", AccountNumber: "532013000"})
+	if err != nil || de != "DE89370400440532013000" {
+		t.Errorf("Generate of a short DE account number returned %s, %v, expected it padded", de, err)
+	}
+	if _, err = Parse("GB28NWBK60161331926819"); !errors.Is(err, ErrChecksum) {
+		t.Errorf("Parse with wrong check digits returned %v, expected %v", err, ErrChecksum)
+	}
+	if _, err = Generate(models.Attributes{Country: models.CountryUS}); !errors.Is(err, ErrUnsupported) {
+		t.Errorf("Generate for US returned %v, expected %v", err, ErrUnsupported)
+	}
+}
@@ -0,0 +1,103 @@
+package account
+
+import (
+	"account/infrastructure"
+	"account/models"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// retry - calls fn until it succeeds, fails with an error that isn't worth
+// retrying, or the attempts configured with WithRetries run out. The wait
+// between attempts doubles each time. When ctx ends while waiting the error
+// wraps ctx.Err() and names the last attempt's error
+func (s *Service) retry(ctx context.Context, fn func(ctx context.Context) error) error {
+	var err error
+	for attempt := 1; attempt <= s.attempts; attempt++ {
+		if attempt > 1 {
+			wait := s.backoff * time.Duration(1<<uint(attempt-2))
+			t := time.NewTimer(wait)
+			select {
+			case <-ctx.Done():
+				t.Stop()
+				return fmt.Errorf("%w waiting to retry, last attempt failed with: %v", ctx.Err(), err)
+			case <-t.C:
+			}
+		}
+
+		err = fn(infrastructure.WithAttempt(ctx, attempt))
+		if err == nil || !retryable(ctx, err) {
+			return err
+		}
+	}
+	return err
+}
+
+// retryable - transport errors, 5xx and 429 are worth another go, as long as
+// the caller hasn't given up
+func retryable(ctx context.Context, err error) bool {
+	if ctx.Err() != nil || errors.Is(err, infrastructure.ErrCircuitOpen) {
+		return false
+	}
+
+	var apiErr *infrastructure.APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.StatusCode >= 500 || apiErr.StatusCode == http.StatusTooManyRequests
+	}
+	var urlErr *url.Error
+	return errors.As(err, &urlErr)
+}
+
+// IsDuplicate - whether err is the account api refusing a create because an
+// account with the same id exists
+func IsDuplicate(err error) bool {
+	return isDuplicate(err)
+}
+
+// isDuplicate - the account api refused the create because the id exists
+func isDuplicate(err error) bool {
+	var apiErr *infrastructure.APIError
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+	return apiErr.StatusCode == http.StatusConflict || strings.Contains(apiErr.Message, "duplicate constraint")
+}
+
+// RecoverDuplicate - for a create of a refused with createErr as a
+// duplicate, the existing account when it's the one a would have created.
+// Otherwise an error, wrapping createErr when the attributes differ. Does
+// what WithDuplicateRecovery does for callers that spot the duplicate
+// themselves, such as a resumed import
+func (s *Service) RecoverDuplicate(ctx context.Context, a models.Account, createErr error) (*models.Account, error) {
+	a, err := s.prepareIDs(a)
+	if err != nil {
+		return nil, err
+	}
+	return s.recoverDuplicate(ctx, a, createErr)
+}
+
+// RecoversDuplicates - whether the service was made WithDuplicateRecovery,
+// when Create already does what RecoverDuplicate does
+func (s *Service) RecoversDuplicates() bool {
+	return s.recoverDuplicates
+}
+
+// recoverDuplicate - a previous attempt (maybe one that timed out) already
+// created the account. When the existing account is the one we were asked
+// to create it's returned as if this call had created it
+func (s *Service) recoverDuplicate(ctx context.Context, a models.Account, createErr error) (*models.Account, error) {
+	existing, err := s.GetByIDContext(ctx, a.ID)
+	if err != nil {
+		return nil, fmt.Errorf("%v, fetching the existing account failed: %w", createErr, err)
+	}
+	if existing.OrganisationID != a.OrganisationID || !reflect.DeepEqual(existing.Attributes, a.Attributes) {
+		return nil, fmt.Errorf("%w, the existing account %s has different attributes", createErr, a.ID)
+	}
+	return existing, nil
+}
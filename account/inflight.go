@@ -0,0 +1,110 @@
+package account
+
+import (
+	"account/models"
+	"context"
+	"sync"
+	"time"
+)
+
+type (
+	// group - coalesces concurrent gets for the same key into a single call
+	// to the account api. The call runs detached from any one caller and is
+	// only cancelled once every caller waiting on it has given up
+	group struct {
+		mu    sync.Mutex
+		calls map[string]*call
+	}
+
+	call struct {
+		done    chan struct{}
+		cancel  context.CancelFunc
+		waiters int
+		account *models.Account
+		err     error
+	}
+
+	// detachedContext - carries the values of its parent (trace ids etc.)
+	// but none of its deadline or cancellation
+	detachedContext struct {
+		parent context.Context
+	}
+)
+
+func (g *group) do(ctx context.Context, key string, fn func(ctx context.Context) (*models.Account, error)) (*models.Account, error) {
+	g.mu.Lock()
+	if g.calls == nil {
+		g.calls = map[string]*call{}
+	}
+	c, ok := g.calls[key]
+	if !ok {
+		callCtx, cancel := context.WithCancel(detachedContext{parent: ctx})
+		c = &call{done: make(chan struct{}), cancel: cancel}
+		g.calls[key] = c
+		go g.run(callCtx, key, c, fn)
+	}
+	c.waiters++
+	g.mu.Unlock()
+
+	select {
+	case <-c.done:
+		return c.result()
+	case <-ctx.Done():
+		g.leave(key, c)
+		return nil, ctx.Err()
+	}
+}
+
+func (g *group) run(ctx context.Context, key string, c *call, fn func(ctx context.Context) (*models.Account, error)) {
+	c.account, c.err = fn(ctx)
+	c.cancel()
+
+	g.mu.Lock()
+	g.forget(key, c)
+	g.mu.Unlock()
+	close(c.done)
+}
+
+// leave - a caller has given up, cancel the shared call if nobody else
+// is waiting on it
+func (g *group) leave(key string, c *call) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	c.waiters--
+	if c.waiters == 0 {
+		c.cancel()
+		g.forget(key, c)
+	}
+}
+
+// forget - stop handing out c to new callers, a fresh call is made instead
+func (g *group) forget(key string, c *call) {
+	if g.calls[key] == c {
+		delete(g.calls, key)
+	}
+}
+
+// result - each caller gets its own copy so one can't mutate another's account
+func (c *call) result() (*models.Account, error) {
+	if c.account == nil {
+		return nil, c.err
+	}
+	account := *c.account
+	return &account, c.err
+}
+
+func (d detachedContext) Deadline() (time.Time, bool) {
+	return time.Time{}, false
+}
+
+func (d detachedContext) Done() <-chan struct{} {
+	return nil
+}
+
+func (d detachedContext) Err() error {
+	return nil
+}
+
+func (d detachedContext) Value(key interface{}) interface{} {
+	return d.parent.Value(key)
+}
@@ -0,0 +1,181 @@
+package infrastructure
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+type (
+	// BreakerState - the state a CircuitBreaker is in
+	BreakerState int
+
+	// BreakerSettings - configures a CircuitBreaker, zero values fall back
+	// to the defaults noted on each field
+	BreakerSettings struct {
+		// FailureThreshold - consecutive failures that open the circuit (5)
+		FailureThreshold int
+		// CoolDown - how long the circuit stays open before letting trial
+		// requests through (30s)
+		CoolDown time.Duration
+		// HalfOpenRequests - trial requests allowed at once while half-open (1)
+		HalfOpenRequests int
+		// OnStateChange - called after every change of state
+		OnStateChange func(from, to BreakerState)
+	}
+
+	// CircuitBreaker - stops requests being made to the account api while
+	// it's failing so callers fail fast with ErrCircuitOpen instead of
+	// waiting on timeouts. Transport errors and 5xx responses count as
+	// failures. Safe for concurrent use and can be shared
+	CircuitBreaker struct {
+		mu       sync.Mutex
+		settings BreakerSettings
+		state    BreakerState
+		failures int
+		openedAt time.Time
+		trials   int
+		// generation - bumped on every change of state, so the outcome of a
+		// request allowed in an earlier state can be told apart and ignored
+		generation uint64
+		now        func() time.Time
+	}
+)
+
+// Circuit breaker states
+const (
+	// StateClosed - requests flow as normal
+	StateClosed BreakerState = iota
+	// StateOpen - requests fail fast with ErrCircuitOpen
+	StateOpen
+	// StateHalfOpen - a limited number of trial requests decide whether the
+	// circuit closes again or re-opens
+	StateHalfOpen
+)
+
+// ErrCircuitOpen - returned without making the request while the circuit is open
+var ErrCircuitOpen = errors.New("circuit breaker is open, account api unavailable")
+
+func (s BreakerState) String() string {
+	switch s {
+	case StateClosed:
+		return "closed"
+	case StateOpen:
+		return "open"
+	case StateHalfOpen:
+		return "half-open"
+	}
+	return "unknown"
+}
+
+// NewCircuitBreaker - returns a closed circuit breaker
+func NewCircuitBreaker(settings BreakerSettings) *CircuitBreaker {
+	if settings.FailureThreshold <= 0 {
+		settings.FailureThreshold = 5
+	}
+	if settings.CoolDown <= 0 {
+		settings.CoolDown = 30 * time.Second
+	}
+	if settings.HalfOpenRequests <= 0 {
+		settings.HalfOpenRequests = 1
+	}
+	return &CircuitBreaker{
+		settings: settings,
+		now:      time.Now,
+	}
+}
+
+// State - the current state of the circuit
+func (b *CircuitBreaker) State() BreakerState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == StateOpen && b.now().Sub(b.openedAt) >= b.settings.CoolDown {
+		return StateHalfOpen
+	}
+	return b.state
+}
+
+// allow - whether a request may be made and the generation it was allowed
+// in, every allowed request must be followed by a call to record or release
+// with that generation
+func (b *CircuitBreaker) allow() (uint64, error) {
+	b.mu.Lock()
+	from := b.state
+	if b.state == StateOpen && b.now().Sub(b.openedAt) >= b.settings.CoolDown {
+		b.set(StateHalfOpen)
+		b.trials = 0
+	}
+
+	var err error
+	switch b.state {
+	case StateOpen:
+		err = ErrCircuitOpen
+	case StateHalfOpen:
+		if b.trials >= b.settings.HalfOpenRequests {
+			err = ErrCircuitOpen
+		} else {
+			b.trials++
+		}
+	}
+	to, generation := b.state, b.generation
+	b.mu.Unlock()
+
+	b.changed(from, to)
+	return generation, err
+}
+
+// record - the outcome of a request allow let through in generation. The
+// outcome of a request allowed before the last change of state is ignored,
+// it says nothing the change didn't already take into account
+func (b *CircuitBreaker) record(generation uint64, failed bool) {
+	b.mu.Lock()
+	from := b.state
+	switch {
+	case generation != b.generation || b.state == StateOpen:
+	case !failed:
+		b.failures = 0
+		if b.state == StateHalfOpen {
+			b.set(StateClosed)
+		}
+	case b.state == StateHalfOpen:
+		b.open()
+	default:
+		b.failures++
+		if b.failures >= b.settings.FailureThreshold {
+			b.open()
+		}
+	}
+	to := b.state
+	b.mu.Unlock()
+
+	b.changed(from, to)
+}
+
+// release - a request allow let through ended without telling us anything
+// about the account api, e.g. the caller cancelled it
+func (b *CircuitBreaker) release(generation uint64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if generation == b.generation && b.state == StateHalfOpen && b.trials > 0 {
+		b.trials--
+	}
+}
+
+func (b *CircuitBreaker) open() {
+	b.set(StateOpen)
+	b.openedAt = b.now()
+	b.failures = 0
+	b.trials = 0
+}
+
+// set - moves to state, starting a new generation
+func (b *CircuitBreaker) set(state BreakerState) {
+	b.state = state
+	b.generation++
+}
+
+func (b *CircuitBreaker) changed(from, to BreakerState) {
+	if from != to && b.settings.OnStateChange != nil {
+		b.settings.OnStateChange(from, to)
+	}
+}
@@ -0,0 +1,93 @@
+package infrastructure
+
+import (
+	"net/http"
+	"sync"
+)
+
+type (
+	// Cache - keeps the validators (ETag & Last-Modified) and the body of
+	// previously fetched resources so that subsequent gets can be revalidated
+	// with the account api instead of re-downloading the whole resource.
+	// A single cache is safe to share between goroutines
+	Cache struct {
+		mu      sync.RWMutex
+		entries map[string]cacheEntry
+	}
+
+	cacheEntry struct {
+		etag         string
+		lastModified string
+		body         []byte
+	}
+)
+
+// NewCache - returns an empty revalidation cache
+func NewCache() *Cache {
+	return &Cache{
+		entries: map[string]cacheEntry{},
+	}
+}
+
+// Len - number of resources currently held in the cache
+func (c *Cache) Len() int {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return len(c.entries)
+}
+
+// Invalidate - drop whatever is held for the given url
+func (c *Cache) Invalidate(url string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.entries, url)
+}
+
+// conditional - adds If-None-Match/If-Modified-Since to the request when the
+// resource it targets has been seen before
+func (c *Cache) conditional(req *http.Request) {
+	c.mu.RLock()
+	entry, ok := c.entries[req.URL.String()]
+	c.mu.RUnlock()
+	if !ok {
+		return
+	}
+
+	if len(entry.etag) > 0 {
+		req.Header.Set("If-None-Match", entry.etag)
+	}
+	if len(entry.lastModified) > 0 {
+		req.Header.Set("If-Modified-Since", entry.lastModified)
+	}
+}
+
+// body - returns the cached body for a 304 response
+func (c *Cache) body(url string) ([]byte, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	entry, ok := c.entries[url]
+	return entry.body, ok
+}
+
+// store - remembers the body of a successful response, only resources that
+// carry a validator are worth keeping since they're the only ones we can
+// revalidate later
+func (c *Cache) store(url string, resp *http.Response, body []byte) {
+	etag := resp.Header.Get("ETag")
+	lastModified := resp.Header.Get("Last-Modified")
+	if len(etag) == 0 && len(lastModified) == 0 {
+		c.Invalidate(url)
+		return
+	}
+
+	b := make([]byte, len(body))
+	copy(b, body)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[url] = cacheEntry{
+		etag:         etag,
+		lastModified: lastModified,
+		body:         b,
+	}
+}
@@ -0,0 +1,286 @@
+// Package chaos - an http.RoundTripper that injects failures on the client
+// side, so how the client copes can be tried against a real environment
+// without touching the account api. Set it as the Transport of the
+// *http.Client given to infrastructure.HTTP
+//
+// Nothing is injected unless the Config is Enabled, a zero Config leaves
+// every request alone
+package chaos
+
+import (
+	"account/internal/duration"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Actions a rule can take
+const (
+	// ActionLatency - waits Delay before sending the request
+	ActionLatency Action = "latency"
+	// ActionDrop - fails the request with ErrDropped without sending it
+	ActionDrop Action = "drop"
+	// ActionError - answers with Status without sending the request
+	ActionError Action = "error"
+	// ActionCut - sends the request, then cuts the response body short
+	// after CutAfter bytes
+	ActionCut Action = "cut"
+)
+
+const defaultStatus = http.StatusServiceUnavailable
+
+// ErrDropped - the error of a dropped request, wrapped in a *url.Error by
+// the http.Client
+var ErrDropped = errors.New("chaos: request dropped")
+
+type (
+	// Action - what a rule does to the requests it picks
+	Action string
+
+	// Config - the rules a Transport injects failures with. Requests are
+	// picked with a random source seeded with Seed, so a run can be
+	// repeated
+	Config struct {
+		Enabled bool   `json:"enabled"`
+		Seed    int64  `json:"seed"`
+		Rules   []Rule `json:"rules"`
+	}
+
+	// Rule - picks Percentage of the requests matching Method and Path for
+	// its Action. Every matching rule is tried in order: latencies add up,
+	// the first drop or error ends the request
+	Rule struct {
+		// Method - empty or "*" matches any
+		Method string `json:"method,omitempty"`
+		// Path - a path.Match pattern of the url path, empty matches any
+		Path string `json:"path,omitempty"`
+		// Percentage - of the matching requests, 0 to 100
+		Percentage float64 `json:"percentage"`
+		Action     Action  `json:"action"`
+		// Delay - for ActionLatency
+		Delay Duration `json:"delay,omitempty"`
+		// Status - for ActionError, defaults to 503
+		Status int `json:"status,omitempty"`
+		// Body - for ActionError, defaults to an error_message naming the
+		// status
+		Body string `json:"body,omitempty"`
+		// Header - for ActionError, such as a Retry-After
+		Header map[string]string `json:"header,omitempty"`
+		// CutAfter - for ActionCut, the bytes of the body read before it
+		// fails with io.ErrUnexpectedEOF
+		CutAfter int `json:"cut_after,omitempty"`
+	}
+
+	// Duration - a time.Duration written as in "250ms" in json
+	Duration = duration.Duration
+
+	// Transport - injects failures into the requests it passes on
+	Transport struct {
+		next   http.RoundTripper
+		config Config
+		mu     sync.Mutex
+		rng    *rand.Rand
+	}
+
+	// cutBody - a response body failing after a number of bytes
+	cutBody struct {
+		io.ReadCloser
+		left int
+	}
+)
+
+// New - a Transport injecting the failures of c into the requests sent
+// through next, http.DefaultTransport when nil
+func New(next http.RoundTripper, c Config) (*Transport, error) {
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return &Transport{next: next, config: c, rng: rand.New(rand.NewSource(c.Seed))}, nil
+}
+
+// LoadConfig - reads a Config from a json file
+func LoadConfig(file string) (Config, error) {
+	var c Config
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return c, err
+	}
+	if err := json.Unmarshal(b, &c); err != nil {
+		return c, fmt.Errorf("%s: %v", file, err)
+	}
+	return c, c.Validate()
+}
+
+// Validate - the rules have known actions, percentages from 0 to 100 and
+// well formed path patterns
+func (c Config) Validate() error {
+	for i, r := range c.Rules {
+		switch r.Action {
+		case ActionLatency, ActionDrop, ActionError, ActionCut:
+		default:
+			return fmt.Errorf("chaos rule %d: unknown action %q", i, r.Action)
+		}
+		if r.Percentage < 0 || r.Percentage > 100 {
+			return fmt.Errorf("chaos rule %d: percentage must be between 0 and 100", i)
+		}
+		if _, err := path.Match(r.Path, ""); err != nil {
+			return fmt.Errorf("chaos rule %d: path %q: %v", i, r.Path, err)
+		}
+		if r.Status != 0 && (r.Status < 100 || r.Status > 599) {
+			return fmt.Errorf("chaos rule %d: invalid status %d", i, r.Status)
+		}
+	}
+	return nil
+}
+
+// RoundTrip - sends req unless a rule drops or answers it, after the delay
+// of any latency rules
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !t.config.Enabled {
+		return t.next.RoundTrip(req)
+	}
+
+	var delay time.Duration
+	var cut *Rule
+	for _, r := range t.picked(req) {
+		switch r.Action {
+		case ActionLatency:
+			delay += time.Duration(r.Delay)
+		case ActionDrop:
+			closeBody(req)
+			if err := wait(req, delay); err != nil {
+				return nil, err
+			}
+			return nil, ErrDropped
+		case ActionError:
+			closeBody(req)
+			if err := wait(req, delay); err != nil {
+				return nil, err
+			}
+			return r.response(req), nil
+		case ActionCut:
+			if cut == nil {
+				cut = r
+			}
+		}
+	}
+
+	if err := wait(req, delay); err != nil {
+		closeBody(req)
+		return nil, err
+	}
+	resp, err := t.next.RoundTrip(req)
+	if err != nil || cut == nil {
+		return resp, err
+	}
+	resp.Body = &cutBody{ReadCloser: resp.Body, left: cut.CutAfter}
+	return resp, nil
+}
+
+// picked - the rules matching req that its draws pick. Each matching rule
+// takes one draw, so the same requests are picked every run with the same
+// seed
+func (t *Transport) picked(req *http.Request) []*Rule {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var rules []*Rule
+	for i := range t.config.Rules {
+		r := &t.config.Rules[i]
+		if !r.matches(req) {
+			continue
+		}
+		if t.rng.Float64()*100 < r.Percentage {
+			rules = append(rules, r)
+		}
+	}
+	return rules
+}
+
+func (r *Rule) matches(req *http.Request) bool {
+	if len(r.Method) > 0 && r.Method != "*" && !strings.EqualFold(r.Method, req.Method) {
+		return false
+	}
+	if len(r.Path) == 0 {
+		return true
+	}
+	ok, _ := path.Match(r.Path, req.URL.Path)
+	return ok
+}
+
+// response - the synthetic response of an error rule
+func (r *Rule) response(req *http.Request) *http.Response {
+	status := r.Status
+	if status == 0 {
+		status = defaultStatus
+	}
+	body := r.Body
+	if len(body) == 0 {
+		b, _ := json.Marshal(map[string]string{"error_message": fmt.Sprintf("chaos: injected %d %s", status, http.StatusText(status))})
+		body = string(b)
+	}
+	header := http.Header{}
+	header.Set("Content-Type", "application/json")
+	header.Set("Content-Length", strconv.Itoa(len(body)))
+	for k, v := range r.Header {
+		header.Set(k, v)
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", status, http.StatusText(status)),
+		StatusCode:    status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          ioutil.NopCloser(bytes.NewReader([]byte(body))),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}
+}
+
+// wait - sleeps for d unless the request is cancelled first
+func wait(req *http.Request, d time.Duration) error {
+	if d <= 0 {
+		return nil
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-req.Context().Done():
+		return req.Context().Err()
+	case <-t.C:
+		return nil
+	}
+}
+
+// closeBody - a RoundTripper closes the request body even when it doesn't
+// send the request
+func closeBody(req *http.Request) {
+	if req.Body != nil {
+		req.Body.Close()
+	}
+}
+
+func (b *cutBody) Read(p []byte) (int, error) {
+	if b.left <= 0 {
+		return 0, io.ErrUnexpectedEOF
+	}
+	if len(p) > b.left {
+		p = p[:b.left]
+	}
+	n, err := b.ReadCloser.Read(p)
+	b.left -= n
+	return n, err
+}
@@ -0,0 +1,132 @@
+package chaos
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+const accountPath = "/v1/organisation/accounts/ad27e265-9605-4b4b-a0e5-3003ea9cc4dc"
+
+func TestTransportInjectsFailures(t *testing.T) {
+	var sent int32
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&sent, 1)
+		w.Write([]byte(`{"data":{"id":"ad27e265-9605-4b4b-a0e5-3003ea9cc4dc"}}`))
+	}))
+	defer s.Close()
+
+	get := func(ctx context.Context, c Config) (*http.Response, []byte, error) {
+		t.Helper()
+		tr, err := New(s.Client().Transport, c)
+		if err != nil {
+			t.Fatalf("New failed with error: %v", err)
+		}
+		req, _ := http.NewRequestWithContext(ctx, http.MethodGet, s.URL+accountPath, nil)
+		resp, err := (&http.Client{Transport: tr}).Do(req)
+		if err != nil {
+			return nil, nil, err
+		}
+		defer resp.Body.Close()
+		b, err := ioutil.ReadAll(resp.Body)
+		return resp, b, err
+	}
+	rule := func(action Action) Rule {
+		return Rule{Method: http.MethodGet, Path: "/v1/organisation/accounts/*", Percentage: 100, Action: action}
+	}
+	ctx := context.Background()
+
+	// rules do nothing until enabled
+	if _, _, err := get(ctx, Config{Rules: []Rule{rule(ActionDrop)}}); err != nil {
+		t.Errorf("GET through disabled chaos failed with error: %v", err)
+	}
+	if _, err := New(nil, Config{Rules: []Rule{{Percentage: 120, Action: ActionDrop}}}); err == nil {
+		t.Error("New accepted a percentage over 100")
+	}
+
+	tooMany := rule(ActionError)
+	tooMany.Status, tooMany.Header = http.StatusTooManyRequests, map[string]string{"Retry-After": "1"}
+	resp, b, err := get(ctx, Config{Enabled: true, Rules: []Rule{tooMany}})
+	if err != nil || resp.StatusCode != http.StatusTooManyRequests || resp.Header.Get("Retry-After") != "1" || !strings.Contains(string(b), "error_message") {
+		t.Errorf("GET with an error rule returned %v, %s, %v, expected a 429 with Retry-After", resp, b, err)
+	}
+
+	before := atomic.LoadInt32(&sent)
+	if _, _, err := get(ctx, Config{Enabled: true, Rules: []Rule{rule(ActionDrop)}}); !errors.Is(err, ErrDropped) {
+		t.Errorf("GET with a drop rule returned %v, expected %v", err, ErrDropped)
+	}
+	if atomic.LoadInt32(&sent) != before {
+		t.Error("a dropped request reached the server")
+	}
+	posts := rule(ActionDrop)
+	posts.Method = http.MethodPost
+	if _, _, err := get(ctx, Config{Enabled: true, Rules: []Rule{posts}}); err != nil {
+		t.Errorf("GET matched a POST rule: %v", err)
+	}
+
+	cut := rule(ActionCut)
+	cut.CutAfter = 10
+	if _, b, err := get(ctx, Config{Enabled: true, Rules: []Rule{cut}}); !errors.Is(err, io.ErrUnexpectedEOF) || len(b) != 10 {
+		t.Errorf("GET with a cut rule read %q, %v, expected 10 bytes then %v", b, err, io.ErrUnexpectedEOF)
+	}
+
+	slow := rule(ActionLatency)
+	slow.Delay = Duration(time.Second)
+	impatient, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	if _, _, err := get(impatient, Config{Enabled: true, Rules: []Rule{slow}}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("GET with a latency rule returned %v, expected %v", err, context.DeadlineExceeded)
+	}
+
+	// the same seed drops the same requests
+	outcomes := func() string {
+		half := rule(ActionDrop)
+		half.Percentage = 50
+		tr, _ := New(s.Client().Transport, Config{Enabled: true, Seed: 9, Rules: []Rule{half}})
+		client := &http.Client{Transport: tr}
+		var b strings.Builder
+		for i := 0; i < 20; i++ {
+			resp, err := client.Get(s.URL + accountPath)
+			if err != nil {
+				b.WriteByte('x')
+				continue
+			}
+			resp.Body.Close()
+			b.WriteByte('.')
+		}
+		return b.String()
+	}
+	first := outcomes()
+	if second := outcomes(); first != second || !strings.Contains(first, "x") || !strings.Contains(first, ".") {
+		t.Errorf("seeded chaos dropped %s then %s, expected the same mix", first, second)
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "chaos")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "chaos.json")
+
+	ioutil.WriteFile(path, []byte(`{"enabled":true,"seed":1,"rules":[{"path":"/v1/*","percentage":10,"action":"latency","delay":"250ms"}]}`), 0600)
+	c, err := LoadConfig(path)
+	if err != nil || !c.Enabled || len(c.Rules) != 1 || c.Rules[0].Delay != Duration(250*time.Millisecond) {
+		t.Errorf("LoadConfig returned %+v, %v", c, err)
+	}
+
+	ioutil.WriteFile(path, []byte(`{"enabled":true,"rules":[{"action":"explode"}]}`), 0600)
+	if _, err := LoadConfig(path); err == nil || !strings.Contains(err.Error(), "unknown action") {
+		t.Errorf("LoadConfig of an unknown action returned %v", err)
+	}
+}
@@ -0,0 +1,46 @@
+package infrastructure
+
+import (
+	"account/metrics"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+)
+
+// APIError - the account api answered with an error_message
+type APIError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("downstream api error: %s", e.Message)
+}
+
+// classify - which metrics error class a request ended in
+func classify(ctx context.Context, status int, err error) string {
+	if err == nil {
+		return ""
+	}
+
+	var netErr net.Error
+	switch {
+	case status == 0 && (ctx.Err() != nil || errors.As(err, &netErr) && netErr.Timeout()):
+		return metrics.ClassTimeout
+	case status == 0:
+		return metrics.ClassTransport
+	case status >= 500:
+		return metrics.ClassServer
+	case status >= 400:
+		return metrics.ClassClient
+	}
+
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &syntaxErr) || errors.As(err, &typeErr) {
+		return metrics.ClassDecode
+	}
+	return metrics.ClassAPI
+}
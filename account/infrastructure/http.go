@@ -1,6 +1,8 @@
 package infrastructure
 
 import (
+	"account/metrics"
+	"account/tracing"
 	"bytes"
 	"context"
 	"encoding/json"
@@ -9,6 +11,8 @@ import (
 	"io/ioutil"
 	"net/http"
 	"net/url"
+	"strings"
+	"time"
 )
 
 type (
@@ -20,12 +24,33 @@ type (
 		UserAgent string
 		Client    *http.Client
 		Context   context.Context
+		// Cache - when set, gets are revalidated with If-None-Match /
+		// If-Modified-Since and a 304 reuses the previously fetched body
+		Cache *Cache
+		// Middleware - ran in order around every request before it's
+		// handed to the Client
+		Middleware []Middleware
+		// Logger - when set, every request is logged with sensitive
+		// fields redacted
+		Logger Logger
+		// Metrics - when set, receives the count, outcome and latency of
+		// every request
+		Metrics metrics.Metrics
+		// Limiter - when set, requests wait for the limiter before they are
+		// sent, share one limiter to keep several services under one limit
+		Limiter *RateLimiter
+		// Breaker - when set, requests fail fast with ErrCircuitOpen while
+		// the account api is failing
+		Breaker *CircuitBreaker
 	}
 
 	request struct {
 		Data interface{} `json:"data,omitempty"`
 	}
 
+	operationKey   struct{}
+	idempotencyKey struct{}
+
 	response struct {
 		Data         interface{} `json:"data,omitempty"`
 		ErrorMessage string      `json:"error_message,omitempty"`
@@ -47,23 +72,67 @@ func NewHTTP(ctx context.Context, httpClient *http.Client, baseURL *url.URL, use
 // Get - make get request to the account api
 // v: response
 func (h *HTTP) Get(path string, v interface{}) error {
-	return h.makeRequest("GET", path, nil, v)
+	return h.GetContext(h.Context, path, v)
+}
+
+// GetContext - make get request to the account api, bound to ctx rather
+// than the context the HTTP was created with
+// v: response
+func (h *HTTP) GetContext(ctx context.Context, path string, v interface{}) error {
+	return h.makeRequest(ctx, "GET", path, nil, v)
 }
 
 // Delete - make get request to the account api
 // v: response
 func (h *HTTP) Delete(path string) error {
-	return h.makeRequest("DELETE", path, nil, nil)
+	return h.DeleteContext(h.Context, path)
+}
+
+// DeleteContext - make delete request to the account api, bound to ctx
+func (h *HTTP) DeleteContext(ctx context.Context, path string) error {
+	return h.makeRequest(ctx, "DELETE", path, nil, nil)
 }
 
 // Post - make post request to the account api
 // data: body of request
 // v: response
 func (h *HTTP) Post(path string, data interface{}, v interface{}) error {
-	return h.makeRequest("POST", path, data, v)
+	return h.PostContext(h.Context, path, data, v)
+}
+
+// PostContext - make post request to the account api, bound to ctx
+// data: body of request
+// v: response
+func (h *HTTP) PostContext(ctx context.Context, path string, data interface{}, v interface{}) error {
+	return h.makeRequest(ctx, "POST", path, data, v)
+}
+
+// WithIdempotencyKey - requests made with ctx carry the key in the
+// Idempotency-Key header, reuse the key when retrying the same request
+func WithIdempotencyKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, idempotencyKey{}, key)
+}
+
+// IdempotencyKey - the key set with WithIdempotencyKey, empty when none is
+func IdempotencyKey(ctx context.Context) string {
+	key, _ := ctx.Value(idempotencyKey{}).(string)
+	return key
+}
+
+// WithOperation - names the account api operation (get/create/delete/list)
+// a request is made for, used to label metrics
+func WithOperation(ctx context.Context, operation string) context.Context {
+	return context.WithValue(ctx, operationKey{}, operation)
+}
+
+func operationFromContext(ctx context.Context, method string) string {
+	if operation, ok := ctx.Value(operationKey{}).(string); ok {
+		return operation
+	}
+	return strings.ToLower(method)
 }
 
-func (h *HTTP) makeRequest(method string, path string, data interface{}, v interface{}) error {
+func (h *HTTP) makeRequest(ctx context.Context, method string, path string, data interface{}, v interface{}) error {
 	urlStr := path
 	rel, err := url.Parse(urlStr)
 	if err != nil {
@@ -71,29 +140,121 @@ func (h *HTTP) makeRequest(method string, path string, data interface{}, v inter
 	}
 	u := h.BaseURL.ResolveReference(rel)
 
-	resp, err := h.do(u.String(), method, data)
+	req, err := h.createRequest(ctx, method, u.String(), data)
+	if err != nil {
+		return err
+	}
+	if h.Cache != nil && method == http.MethodGet {
+		h.Cache.conditional(req)
+	}
+
+	operation := operationFromContext(ctx, method)
+	if h.Metrics != nil {
+		h.Metrics.RequestStarted(operation)
+	}
+	start := time.Now()
+	resp, err := h.do(ctx, req)
+	if err != nil {
+		h.finish(ctx, operation, req, nil, nil, err, time.Since(start))
+		return err
+	}
 	defer resp.Body.Close()
 
-	err = unmarshalResponse(resp, v)
+	body, err := h.readBody(req, resp)
+	if err == nil {
+		err = unmarshalResponse(resp.StatusCode, body, v)
+	}
+	h.finish(ctx, operation, req, resp, body, err, time.Since(start))
 
 	return err
 }
 
-func (h *HTTP) do(url, method string, data interface{}) (*http.Response, error) {
-	req, err := h.createRequest(method, url, data)
+// finish - reports the outcome of a request to the logger and metrics
+func (h *HTTP) finish(ctx context.Context, operation string, req *http.Request, resp *http.Response, body []byte, err error, d time.Duration) {
+	h.logRequest(ctx, req, resp, body, err, d)
+
+	status := 0
+	if resp != nil {
+		status = resp.StatusCode
+	}
+	if h.Metrics != nil {
+		h.Metrics.RequestFinished(operation, status, classify(ctx, status, err), d)
+	}
+
+	span := tracing.SpanFromContext(ctx)
+	span.SetAttribute("http.status_code", status)
+	span.SetAttribute("account.retries", attemptFromContext(ctx)-1)
+}
+
+func (h *HTTP) do(ctx context.Context, req *http.Request) (*http.Response, error) {
+	var generation uint64
+	if h.Breaker != nil {
+		var err error
+		if generation, err = h.Breaker.allow(); err != nil {
+			return nil, err
+		}
+	}
+	if h.Limiter != nil {
+		if err := h.Limiter.Wait(ctx); err != nil {
+			if h.Breaker != nil {
+				h.Breaker.release(generation)
+			}
+			return nil, err
+		}
+	}
+
+	resp, err := chain(h.Client, h.Middleware).Do(req.WithContext(ctx))
+	if h.Breaker != nil {
+		switch {
+		case err != nil && ctx.Err() != nil:
+			// the caller giving up says nothing about the health of the account api
+			h.Breaker.release(generation)
+		default:
+			h.Breaker.record(generation, err != nil || resp.StatusCode >= 500)
+		}
+	}
 	if err != nil {
 		return nil, err
 	}
+	if h.Limiter != nil {
+		h.Limiter.Observe(resp)
+	}
 
-	resp, err := h.Client.Do(req.WithContext(h.Context))
+	return resp, nil
+}
+
+// readBody - reads the response body, swapping in the cached body when the
+// account api tells us the resource hasn't changed
+func (h *HTTP) readBody(req *http.Request, resp *http.Response) ([]byte, error) {
+	body, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
 		return nil, err
 	}
+	if h.Cache == nil {
+		return body, nil
+	}
 
-	return resp, nil
+	key := req.URL.String()
+	switch {
+	case req.Method == http.MethodGet && resp.StatusCode == http.StatusNotModified:
+		cached, ok := h.Cache.body(key)
+		if !ok {
+			return nil, fmt.Errorf("%s returned not modified but nothing is cached", key)
+		}
+		return cached, nil
+	case req.Method == http.MethodGet && resp.StatusCode == http.StatusOK:
+		h.Cache.store(key, resp, body)
+	case req.Method == http.MethodDelete:
+		// deletes carry the version in the query, the cached get doesn't
+		u := *req.URL
+		u.RawQuery = ""
+		h.Cache.Invalidate(u.String())
+	}
+
+	return body, nil
 }
 
-func (h *HTTP) createRequest(method, url string, data interface{}) (*http.Request, error) {
+func (h *HTTP) createRequest(ctx context.Context, method, url string, data interface{}) (*http.Request, error) {
 	var body io.Reader
 	if data != nil {
 		b, err := json.Marshal(request{Data: data})
@@ -111,21 +272,25 @@ func (h *HTTP) createRequest(method, url string, data interface{}) (*http.Reques
 	if data != nil {
 		req.Header.Set("Content-Type", "application/json")
 	}
+	if key := IdempotencyKey(ctx); len(key) > 0 {
+		req.Header.Set("Idempotency-Key", key)
+	}
+	if sc, ok := tracing.SpanContextFromContext(ctx); ok {
+		req.Header.Set("traceparent", sc.TraceParent())
+		if len(sc.TraceState) > 0 {
+			req.Header.Set("tracestate", sc.TraceState)
+		}
+	}
 	return req, nil
 }
 
-func unmarshalResponse(r *http.Response, v interface{}) error {
-	body, err := ioutil.ReadAll(r.Body)
-	if err != nil {
-		return err
-	}
-
-	bodyString := string(body)
-	if len(bodyString) > 0 {
+func unmarshalResponse(status int, body []byte, v interface{}) error {
+	var err error
+	if len(body) > 0 {
 		res := &response{Data: v}
-		err = json.Unmarshal([]byte(bodyString), res)
+		err = json.Unmarshal(body, res)
 		if len(res.ErrorMessage) > 0 {
-			err = fmt.Errorf("downstream api error: %s", res.ErrorMessage)
+			err = &APIError{StatusCode: status, Message: res.ErrorMessage}
 		}
 	}
 
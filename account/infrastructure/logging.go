@@ -0,0 +1,128 @@
+package infrastructure
+
+import (
+	"account/models"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"time"
+)
+
+type (
+	// Logger - the subset of *slog.Logger the client logs through, a
+	// *slog.Logger (or anything with the same methods) can be used as is.
+	// Requests are logged at info, bodies at debug so the level of the
+	// logger decides whether bodies are included
+	Logger interface {
+		Debug(msg string, args ...interface{})
+		Info(msg string, args ...interface{})
+		Error(msg string, args ...interface{})
+	}
+
+	attemptKey struct{}
+)
+
+// WithAttempt - records which attempt at a request ctx belongs to so it's
+// reported alongside the request
+func WithAttempt(ctx context.Context, attempt int) context.Context {
+	return context.WithValue(ctx, attemptKey{}, attempt)
+}
+
+func attemptFromContext(ctx context.Context) int {
+	if attempt, ok := ctx.Value(attemptKey{}).(int); ok {
+		return attempt
+	}
+	return 1
+}
+
+// logRequest - logs the outcome of a request, bodies are always redacted
+func (h *HTTP) logRequest(ctx context.Context, req *http.Request, resp *http.Response, body []byte, err error, d time.Duration) {
+	if h.Logger == nil {
+		return
+	}
+
+	args := []interface{}{
+		"method", req.Method,
+		"path", req.URL.Path,
+		"duration", d,
+		"attempt", attemptFromContext(ctx),
+	}
+	if resp != nil {
+		args = append(args, "status", resp.StatusCode)
+	}
+
+	if err != nil {
+		h.Logger.Error("account api request failed", append(args, "error", err)...)
+	} else {
+		h.Logger.Info("account api request", args...)
+	}
+
+	if req.GetBody != nil {
+		if b, err := req.GetBody(); err == nil {
+			sent, _ := ioutil.ReadAll(b)
+			h.Logger.Debug("account api request body", "method", req.Method, "path", req.URL.Path, "body", string(Redact(sent)))
+		}
+	}
+	if len(body) > 0 {
+		h.Logger.Debug("account api response body", "method", req.Method, "path", req.URL.Path, "body", string(Redact(body)))
+	}
+}
+
+// redactedFields - json fields holding personal or account identifying data
+var redactedFields = map[string]bool{
+	"account_number":                 true,
+	"alternative_bank_account_names": true,
+	"bic":                            true,
+	"customer_id":                    true,
+	"first_name":                     true,
+	"iban":                           true,
+	"last_name":                      true,
+	"name":                           true,
+	"names":                          true,
+}
+
+// Redact - masks the personal and account identifying fields wherever they
+// appear in a json body. A body that isn't json is masked entirely since
+// there's no telling what's in it
+func Redact(body []byte) []byte {
+	if len(bytes.TrimSpace(body)) == 0 {
+		return body
+	}
+
+	d := json.NewDecoder(bytes.NewReader(body))
+	d.UseNumber()
+	var v interface{}
+	if err := d.Decode(&v); err != nil {
+		return []byte(models.Redacted)
+	}
+
+	b, err := json.Marshal(redact(v, false))
+	if err != nil {
+		return []byte(models.Redacted)
+	}
+	return b
+}
+
+func redact(v interface{}, sensitive bool) interface{} {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		for k, child := range t {
+			t[k] = redact(child, sensitive || redactedFields[k])
+		}
+		return t
+	case []interface{}:
+		for i, child := range t {
+			t[i] = redact(child, sensitive)
+		}
+		return t
+	case nil:
+		return nil
+	default:
+		if sensitive {
+			return models.Redacted
+		}
+		return t
+	}
+}
@@ -0,0 +1,31 @@
+package infrastructure
+
+import "net/http"
+
+type (
+	// Doer - anything that can carry out a http request, *http.Client is one
+	Doer interface {
+		Do(req *http.Request) (*http.Response, error)
+	}
+
+	// DoerFunc - lets an ordinary function be used as a Doer
+	DoerFunc func(req *http.Request) (*http.Response, error)
+
+	// Middleware - wraps the next Doer in the chain so a request/response can
+	// be inspected or changed on its way to and from the account api
+	Middleware func(next Doer) Doer
+)
+
+// Do - calls f(req)
+func (f DoerFunc) Do(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// chain - wraps d in the middlewares, the first middleware is the outermost
+// so it sees the request first and the response last
+func chain(d Doer, middlewares []Middleware) Doer {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		d = middlewares[i](d)
+	}
+	return d
+}
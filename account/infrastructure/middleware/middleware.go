@@ -0,0 +1,61 @@
+// Package middleware - ready made middlewares for the common concerns,
+// configure them on infrastructure.HTTP.Middleware
+package middleware
+
+import (
+	"account/infrastructure"
+	"net/http"
+	"time"
+)
+
+// Header - sets the header on every request
+func Header(key, value string) infrastructure.Middleware {
+	return func(next infrastructure.Doer) infrastructure.Doer {
+		return infrastructure.DoerFunc(func(req *http.Request) (*http.Response, error) {
+			req.Header.Set(key, value)
+			return next.Do(req)
+		})
+	}
+}
+
+// BearerToken - authenticates every request with the token
+func BearerToken(token string) infrastructure.Middleware {
+	return Header("Authorization", "Bearer "+token)
+}
+
+// Logging - writes a line per request with the method, url, status and
+// how long it took
+func Logging(logf func(format string, args ...interface{})) infrastructure.Middleware {
+	return Observe(func(req *http.Request, resp *http.Response, err error, d time.Duration) {
+		if err != nil {
+			logf("%s %s failed after %v: %v", req.Method, req.URL, d, err)
+			return
+		}
+		logf("%s %s %d in %v", req.Method, req.URL, resp.StatusCode, d)
+	})
+}
+
+// Observe - calls fn once each request is done, useful for metrics
+func Observe(fn func(req *http.Request, resp *http.Response, err error, d time.Duration)) infrastructure.Middleware {
+	return func(next infrastructure.Doer) infrastructure.Doer {
+		return infrastructure.DoerFunc(func(req *http.Request) (*http.Response, error) {
+			start := time.Now()
+			resp, err := next.Do(req)
+			fn(req, resp, err, time.Since(start))
+			return resp, err
+		})
+	}
+}
+
+// Fault - fails requests for which fail returns true with err instead of
+// sending them, handy to exercise error handling
+func Fault(fail func(req *http.Request) bool, err error) infrastructure.Middleware {
+	return func(next infrastructure.Doer) infrastructure.Doer {
+		return infrastructure.DoerFunc(func(req *http.Request) (*http.Response, error) {
+			if fail(req) {
+				return nil, err
+			}
+			return next.Do(req)
+		})
+	}
+}
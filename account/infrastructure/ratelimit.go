@@ -0,0 +1,120 @@
+package infrastructure
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// RateLimiter - a token bucket limiting how fast requests are made to the
+// account api. One limiter can be shared by several HTTP structs (and so
+// several services) to keep them under a common limit. The rate backs off
+// when the account api signals it's being pushed too hard and recovers
+// gradually afterwards
+type RateLimiter struct {
+	mu       sync.Mutex
+	limit    float64
+	rate     float64
+	burst    float64
+	tokens   float64
+	last     time.Time
+	now      func() time.Time
+	minRate  float64
+	recovery float64
+}
+
+// NewRateLimiter - allows requestsPerSecond on average with bursts of up to
+// burst requests. Panics when requestsPerSecond isn't greater than 0, as no
+// request could ever be made
+func NewRateLimiter(requestsPerSecond float64, burst int) *RateLimiter {
+	if !(requestsPerSecond > 0) {
+		panic(fmt.Sprintf("infrastructure: rate limit must be greater than 0 requests per second, got %v", requestsPerSecond))
+	}
+	if burst < 1 {
+		burst = 1
+	}
+	return &RateLimiter{
+		limit:    requestsPerSecond,
+		rate:     requestsPerSecond,
+		burst:    float64(burst),
+		tokens:   float64(burst),
+		now:      time.Now,
+		minRate:  requestsPerSecond / 16,
+		recovery: 1.1,
+	}
+}
+
+// Rate - the current rate in requests per second, lower than configured
+// while backing off
+func (l *RateLimiter) Rate() float64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.rate
+}
+
+// Wait - blocks until a request may be made or ctx is done
+func (l *RateLimiter) Wait(ctx context.Context) error {
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		l.mu.Lock()
+		l.refill()
+		if l.tokens >= 1 {
+			l.tokens--
+			l.mu.Unlock()
+			return nil
+		}
+		wait := time.Duration((1 - l.tokens) / l.rate * float64(time.Second))
+		l.mu.Unlock()
+
+		t := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return ctx.Err()
+		case <-t.C:
+		}
+	}
+}
+
+// Observe - adapts the rate to the response. A 429 halves it, as does the
+// account api reporting it has almost no requests remaining, otherwise the
+// rate creeps back up towards the configured one
+func (l *RateLimiter) Observe(resp *http.Response) {
+	if resp == nil {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.refill()
+
+	if resp.StatusCode == http.StatusTooManyRequests || l.nearlyExhausted(resp) {
+		l.rate = math.Max(l.rate/2, l.minRate)
+		// drain the bucket so the burst doesn't immediately hit the limit again
+		l.tokens = math.Min(l.tokens, 0)
+		return
+	}
+	l.rate = math.Min(l.rate*l.recovery, l.limit)
+}
+
+func (l *RateLimiter) nearlyExhausted(resp *http.Response) bool {
+	remaining, err := strconv.Atoi(resp.Header.Get("X-RateLimit-Remaining"))
+	if err != nil {
+		return false
+	}
+	return float64(remaining) <= l.burst
+}
+
+func (l *RateLimiter) refill() {
+	now := l.now()
+	if !l.last.IsZero() {
+		l.tokens = math.Min(l.tokens+now.Sub(l.last).Seconds()*l.rate, l.burst)
+	}
+	l.last = now
+}
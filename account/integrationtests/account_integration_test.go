@@ -150,9 +150,9 @@ func TestCreateSuccess(t *testing.T) {
 
 	accountToCreate := models.Account{
 		Attributes:     attr,
-		CreatedOn:      "2020-08-25T21:24:39.999Z",
+		CreatedOn:      createdOn,
 		ID:             id,
-		ModifiedOn:     "2020-08-25T21:24:39.999Z",
+		ModifiedOn:     createdOn,
 		OrganisationID: "da968913-79ae-4a1c-8490-5597d28ecf5b",
 		Type:           "accounts",
 		Version:        0,
@@ -169,9 +169,9 @@ func TestCreateSuccess(t *testing.T) {
 
 	want := &models.Account{
 		Attributes:     attr,
-		CreatedOn:      "2020-08-25T21:24:39.999Z",
+		CreatedOn:      createdOn,
 		ID:             id,
-		ModifiedOn:     "2020-08-25T21:24:39.999Z",
+		ModifiedOn:     createdOn,
 		OrganisationID: "da968913-79ae-4a1c-8490-5597d28ecf5b",
 		Type:           "accounts",
 		Version:        0,
@@ -201,9 +201,9 @@ func TestCreateFailure(t *testing.T) {
 
 	accountToCreate := models.Account{
 		Attributes:     attr,
-		CreatedOn:      "2020-08-25T21:24:39.999Z",
+		CreatedOn:      createdOn,
 		ID:             "da968913",
-		ModifiedOn:     "2020-08-25T21:24:39.999Z",
+		ModifiedOn:     createdOn,
 		OrganisationID: "da968913-79ae-4a1c-8490-5597d28ecf5b",
 		Type:           "accounts",
 		Version:        0,
@@ -213,8 +213,8 @@ func TestCreateFailure(t *testing.T) {
 	accountService := account.NewService(h)
 	_, err := accountService.Create(accountToCreate)
 
-	if !strings.Contains(err.Error(), "downstream api error") {
-		t.Error("GetByID not non existent account did not return expected error")
+	if !strings.Contains(err.Error(), "is not a valid uuid") {
+		t.Error("Create with an invalid id did not return expected error")
 	}
 }
 
@@ -1,11 +1,15 @@
 package integrationtests
 
 import (
+	"account/models"
 	"fmt"
 
 	"github.com/google/uuid"
 )
 
+// createdOn - created_on and modified_on sent in the create tests
+var createdOn, _ = models.ParseTimestamp("2020-08-25T21:24:39.999Z")
+
 // GenerateUUID - generate ids for test
 func GenerateUUID() string {
 	uuid, _ := uuid.NewUUID()
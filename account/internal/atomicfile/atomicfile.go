@@ -0,0 +1,40 @@
+// Package atomicfile - replaces files in one go, so a crash never leaves
+// half of one. Used for the bulk checkpoint, the watch cursor, the fake
+// account api's store and accountctl's snapshots
+package atomicfile
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// Write - writes b to a temporary file next to path, syncs it and renames
+// it over path
+func Write(path string, b []byte) error {
+	return WriteFunc(path, func(w io.Writer) error {
+		_, err := w.Write(b)
+		return err
+	})
+}
+
+// WriteFunc - Write of what fn writes, for files too big to build in
+// memory first. path is left as it was when fn fails
+func WriteFunc(path string, fn func(w io.Writer) error) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if err = fn(tmp); err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
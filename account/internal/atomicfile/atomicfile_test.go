@@ -0,0 +1,44 @@
+package atomicfile
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWrite(t *testing.T) {
+	dir, err := ioutil.TempDir("", "atomicfile")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "state.json")
+
+	for _, want := range []string{`{"offset":1}`, `{"offset":2}`} {
+		if err := Write(path, []byte(want)); err != nil {
+			t.Fatalf("Write failed with error: %v", err)
+		}
+		if b, err := ioutil.ReadFile(path); err != nil || string(b) != want {
+			t.Errorf("the file holds %s, %v, expected %s", b, err, want)
+		}
+	}
+	if files, _ := ioutil.ReadDir(dir); len(files) != 1 {
+		t.Errorf("Write left %d files, expected only the one written", len(files))
+	}
+
+	failed := errors.New("failed")
+	err = WriteFunc(path, func(w io.Writer) error {
+		w.Write([]byte(`{"offset":3}`))
+		return failed
+	})
+	if b, _ := ioutil.ReadFile(path); err != failed || string(b) != `{"offset":2}` {
+		t.Errorf("WriteFunc returned %v and left %s, expected its error and the file as it was", err, b)
+	}
+
+	if err := Write(filepath.Join(dir, "missing", "state.json"), nil); err == nil {
+		t.Error("Write into a missing directory succeeded, expected an error")
+	}
+}
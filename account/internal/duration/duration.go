@@ -0,0 +1,38 @@
+// Package duration - a time.Duration written as in "250ms" in json, shared
+// by the json configs of the fake account api and the chaos transport
+package duration
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// Duration - a time.Duration written as in "250ms" in json
+type Duration time.Duration
+
+// MarshalJSON - the duration as in "250ms"
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// UnmarshalJSON - a duration as in "250ms", or a number of nanoseconds
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var v interface{}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	switch v := v.(type) {
+	case float64:
+		*d = Duration(v)
+	case string:
+		parsed, err := time.ParseDuration(v)
+		if err != nil {
+			return err
+		}
+		*d = Duration(parsed)
+	default:
+		return errors.New("duration must be a string or a number")
+	}
+	return nil
+}
@@ -0,0 +1,28 @@
+package duration
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestDurationJSON(t *testing.T) {
+	b, err := json.Marshal(Duration(250 * time.Millisecond))
+	if err != nil || string(b) != `"250ms"` {
+		t.Errorf("Marshal returned %s, %v, expected \"250ms\"", b, err)
+	}
+
+	for in, want := range map[string]Duration{`"1.5s"`: Duration(1500 * time.Millisecond), `1000`: Duration(time.Microsecond)} {
+		var d Duration
+		if err := json.Unmarshal([]byte(in), &d); err != nil || d != want {
+			t.Errorf("Unmarshal(%s) returned %v, %v, expected %v", in, time.Duration(d), err, time.Duration(want))
+		}
+	}
+	var d Duration
+	if err := json.Unmarshal([]byte(`"soon"`), &d); err == nil {
+		t.Error("Unmarshal of \"soon\" succeeded, expected an error")
+	}
+	if err := json.Unmarshal([]byte(`true`), &d); err == nil {
+		t.Error("Unmarshal of true succeeded, expected an error")
+	}
+}
@@ -0,0 +1,32 @@
+// Package metrics - instrumentation of the calls made to the account api.
+// Registry is the default in-process implementation, it can be published
+// through expvar and scraped in the Prometheus text format
+package metrics
+
+import (
+	"time"
+)
+
+// Error classes, what kind of failure a request ended in
+const (
+	// ClassTransport - the request never got a response
+	ClassTransport = "transport"
+	// ClassTimeout - the request was cancelled or timed out
+	ClassTimeout = "timeout"
+	// ClassClient - the account api rejected the request (4xx)
+	ClassClient = "client"
+	// ClassServer - the account api failed (5xx)
+	ClassServer = "server"
+	// ClassAPI - the account api answered with an error message
+	ClassAPI = "api"
+	// ClassDecode - the response couldn't be decoded
+	ClassDecode = "decode"
+)
+
+// Metrics - receives a call when a request to the account api starts and
+// when it finishes. Operation is one of get/create/delete/list, status is 0
+// when there was no response and class is empty on success
+type Metrics interface {
+	RequestStarted(operation string)
+	RequestFinished(operation string, status int, class string, d time.Duration)
+}
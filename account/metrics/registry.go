@@ -0,0 +1,248 @@
+package metrics
+
+import (
+	"expvar"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+type (
+	// Registry - keeps counters, latency histograms and in-flight gauges
+	// in memory, safe for concurrent use
+	Registry struct {
+		mu        sync.Mutex
+		buckets   []float64
+		requests  map[requestKey]int64
+		errors    map[errorKey]int64
+		latencies map[string]*histogram
+		inFlight  map[string]int64
+	}
+
+	requestKey struct {
+		Operation string
+		Status    int
+	}
+
+	errorKey struct {
+		Operation string
+		Class     string
+	}
+
+	histogram struct {
+		counts []int64
+		count  int64
+		sum    float64
+	}
+
+	// Snapshot - a point in time copy of what a Registry has recorded
+	Snapshot struct {
+		// Requests - operation -> status code -> count
+		Requests map[string]map[int]int64 `json:"requests"`
+		// Errors - operation -> error class -> count
+		Errors map[string]map[string]int64 `json:"errors"`
+		// Latency - operation -> latency histogram
+		Latency map[string]Histogram `json:"latency"`
+		// InFlight - operation -> requests currently in flight
+		InFlight map[string]int64 `json:"in_flight"`
+	}
+
+	// Histogram - cumulative counts per upper bound (in seconds)
+	Histogram struct {
+		Buckets map[string]int64 `json:"buckets"`
+		Count   int64            `json:"count"`
+		Sum     float64          `json:"sum"`
+	}
+)
+
+// DefaultBuckets - latency buckets in seconds
+var DefaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// NewRegistry - returns an empty registry using DefaultBuckets
+func NewRegistry() *Registry {
+	return &Registry{
+		buckets:   DefaultBuckets,
+		requests:  map[requestKey]int64{},
+		errors:    map[errorKey]int64{},
+		latencies: map[string]*histogram{},
+		inFlight:  map[string]int64{},
+	}
+}
+
+// RequestStarted - see Metrics
+func (r *Registry) RequestStarted(operation string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.inFlight[operation]++
+}
+
+// RequestFinished - see Metrics
+func (r *Registry) RequestFinished(operation string, status int, class string, d time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.inFlight[operation]--
+	r.requests[requestKey{operation, status}]++
+	if len(class) > 0 {
+		r.errors[errorKey{operation, class}]++
+	}
+
+	h, ok := r.latencies[operation]
+	if !ok {
+		h = &histogram{counts: make([]int64, len(r.buckets))}
+		r.latencies[operation] = h
+	}
+	seconds := d.Seconds()
+	for i, upper := range r.buckets {
+		if seconds <= upper {
+			h.counts[i]++
+		}
+	}
+	h.count++
+	h.sum += seconds
+}
+
+// Snapshot - copy of everything recorded so far
+func (r *Registry) Snapshot() Snapshot {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	s := Snapshot{
+		Requests: map[string]map[int]int64{},
+		Errors:   map[string]map[string]int64{},
+		Latency:  map[string]Histogram{},
+		InFlight: map[string]int64{},
+	}
+	for k, v := range r.requests {
+		if s.Requests[k.Operation] == nil {
+			s.Requests[k.Operation] = map[int]int64{}
+		}
+		s.Requests[k.Operation][k.Status] = v
+	}
+	for k, v := range r.errors {
+		if s.Errors[k.Operation] == nil {
+			s.Errors[k.Operation] = map[string]int64{}
+		}
+		s.Errors[k.Operation][k.Class] = v
+	}
+	for op, h := range r.latencies {
+		buckets := map[string]int64{}
+		for i, upper := range r.buckets {
+			buckets[formatFloat(upper)] = h.counts[i]
+		}
+		s.Latency[op] = Histogram{Buckets: buckets, Count: h.count, Sum: h.sum}
+	}
+	for op, v := range r.inFlight {
+		s.InFlight[op] = v
+	}
+	return s
+}
+
+// Publish - exposes the registry through expvar (/debug/vars) under name.
+// Like expvar.Publish it panics if name is already in use
+func (r *Registry) Publish(name string) {
+	expvar.Publish(name, expvar.Func(func() interface{} {
+		return r.Snapshot()
+	}))
+}
+
+// Handler - serves the registry in the Prometheus text exposition format
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		r.WriteText(w)
+	})
+}
+
+// WriteText - writes the registry in the Prometheus text exposition format
+func (r *Registry) WriteText(w io.Writer) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	p := &printer{w: w}
+
+	p.header("account_api_requests_total", "counter", "Requests made to the account api.")
+	requestKeys := make([]requestKey, 0, len(r.requests))
+	for k := range r.requests {
+		requestKeys = append(requestKeys, k)
+	}
+	sort.Slice(requestKeys, func(i, j int) bool {
+		if requestKeys[i].Operation != requestKeys[j].Operation {
+			return requestKeys[i].Operation < requestKeys[j].Operation
+		}
+		return requestKeys[i].Status < requestKeys[j].Status
+	})
+	for _, k := range requestKeys {
+		p.printf("account_api_requests_total{operation=%q,status=\"%d\"} %d\n", k.Operation, k.Status, r.requests[k])
+	}
+
+	p.header("account_api_errors_total", "counter", "Failed requests to the account api by error class.")
+	errorKeys := make([]errorKey, 0, len(r.errors))
+	for k := range r.errors {
+		errorKeys = append(errorKeys, k)
+	}
+	sort.Slice(errorKeys, func(i, j int) bool {
+		if errorKeys[i].Operation != errorKeys[j].Operation {
+			return errorKeys[i].Operation < errorKeys[j].Operation
+		}
+		return errorKeys[i].Class < errorKeys[j].Class
+	})
+	for _, k := range errorKeys {
+		p.printf("account_api_errors_total{operation=%q,class=%q} %d\n", k.Operation, k.Class, r.errors[k])
+	}
+
+	p.header("account_api_request_duration_seconds", "histogram", "Latency of requests to the account api.")
+	for _, op := range sortedKeys(r.latencies) {
+		h := r.latencies[op]
+		for i, upper := range r.buckets {
+			p.printf("account_api_request_duration_seconds_bucket{operation=%q,le=%q} %d\n", op, formatFloat(upper), h.counts[i])
+		}
+		p.printf("account_api_request_duration_seconds_bucket{operation=%q,le=\"+Inf\"} %d\n", op, h.count)
+		p.printf("account_api_request_duration_seconds_sum{operation=%q} %s\n", op, formatFloat(h.sum))
+		p.printf("account_api_request_duration_seconds_count{operation=%q} %d\n", op, h.count)
+	}
+
+	p.header("account_api_requests_in_flight", "gauge", "Requests to the account api currently in flight.")
+	inFlight := make([]string, 0, len(r.inFlight))
+	for op := range r.inFlight {
+		inFlight = append(inFlight, op)
+	}
+	sort.Strings(inFlight)
+	for _, op := range inFlight {
+		p.printf("account_api_requests_in_flight{operation=%q} %d\n", op, r.inFlight[op])
+	}
+
+	return p.err
+}
+
+// printer - remembers the first write error so WriteText reads top to bottom
+type printer struct {
+	w   io.Writer
+	err error
+}
+
+func (p *printer) printf(format string, args ...interface{}) {
+	if p.err != nil {
+		return
+	}
+	_, p.err = fmt.Fprintf(p.w, format, args...)
+}
+
+func (p *printer) header(name, kind, help string) {
+	p.printf("# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+func sortedKeys(m map[string]*histogram) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
@@ -1,12 +1,47 @@
 package models
 
+import "encoding/json"
+
 // Account - represents an account object
 type Account struct {
 	Attributes     Attributes `json:"attributes"`
-	CreatedOn      string     `json:"created_on,omitempty"`
+	CreatedOn      Timestamp  `json:"created_on"`
 	ID             string     `json:"id,omitempty"`
-	ModifiedOn     string     `json:"modified_on,omitempty"`
+	ModifiedOn     Timestamp  `json:"modified_on"`
 	OrganisationID string     `json:"organisation_id,omitempty"`
 	Type           string     `json:"type,omitempty"`
 	Version        int32      `json:"version,omitempty"`
 }
+
+// Redacted - what sensitive values are replaced with, in accounts and in
+// the bodies the infrastructure logs
+const Redacted = "[REDACTED]"
+
+// Redacted - a copy of the account that is safe to log, the personal and
+// account identifying attributes are masked
+func (a Account) Redacted() Account {
+	a.Attributes = a.Attributes.Redacted()
+	return a
+}
+
+// MarshalJSON - leaves out created_on and modified_on when they're zero,
+// the account api sets them itself on create
+func (a Account) MarshalJSON() ([]byte, error) {
+	type account Account
+	return json.Marshal(struct {
+		account
+		CreatedOn  *Timestamp `json:"created_on,omitempty"`
+		ModifiedOn *Timestamp `json:"modified_on,omitempty"`
+	}{
+		account:    account(a),
+		CreatedOn:  optionalTimestamp(a.CreatedOn),
+		ModifiedOn: optionalTimestamp(a.ModifiedOn),
+	})
+}
+
+func optionalTimestamp(t Timestamp) *Timestamp {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
@@ -2,14 +2,31 @@ package models
 
 // Attributes - account atrributes
 type Attributes struct {
-	AccountClassification       string `json:"account_classification,omitempty"`
-	AccountNumber               string `json:"account_number,omitempty"`
-	AlternativeBankAccountNames string `json:"alternative_bank_account_names,omitempty"`
-	BankID                      string `json:"bank_id,omitempty"`
-	BankIDCode                  string `json:"bank_id_code,omitempty"`
-	BaseCurrency                string `json:"base_currency,omitempty"`
-	Bic                         string `json:"bic"`
-	Country                     string `json:"country,omitempty"`
-	CustomerID                  string `json:"customer_id,omitempty"`
-	IBAN                        string `json:"iban,omitempty"`
+	AccountClassification       Classification `json:"account_classification,omitempty"`
+	AccountNumber               string         `json:"account_number,omitempty"`
+	AlternativeBankAccountNames string         `json:"alternative_bank_account_names,omitempty"`
+	BankID                      string         `json:"bank_id,omitempty"`
+	BankIDCode                  BankIDCode     `json:"bank_id_code,omitempty"`
+	BaseCurrency                Currency       `json:"base_currency,omitempty"`
+	Bic                         string         `json:"bic"`
+	Country                     Country        `json:"country,omitempty"`
+	CustomerID                  string         `json:"customer_id,omitempty"`
+	IBAN                        string         `json:"iban,omitempty"`
+}
+
+// Redacted - a copy of the attributes with iban, account number, bic,
+// customer id and names masked
+func (a Attributes) Redacted() Attributes {
+	for _, field := range []*string{
+		&a.AccountNumber,
+		&a.AlternativeBankAccountNames,
+		&a.Bic,
+		&a.CustomerID,
+		&a.IBAN,
+	} {
+		if len(*field) > 0 {
+			*field = Redacted
+		}
+	}
+	return a
 }
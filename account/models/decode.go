@@ -0,0 +1,110 @@
+package models
+
+import (
+	"encoding/json"
+	"io"
+	"reflect"
+)
+
+type (
+	// DecodeOption - changes how a Decoder decodes
+	DecodeOption func(d *Decoder)
+
+	// Decoder - a json.Decoder for accounts, attributes and anything holding
+	// them. Unknown classifications, countries, currencies and bank id codes
+	// are passed through as is unless it's made with StrictDecoding
+	Decoder struct {
+		*json.Decoder
+		strict bool
+	}
+
+	// enum - the string types with a set of known values
+	enum interface {
+		Valid() bool
+		kind() string
+	}
+)
+
+// StrictDecoding - reject unknown classifications, countries, currencies and
+// bank id codes with a *UnknownValueError
+func StrictDecoding() DecodeOption {
+	return func(d *Decoder) {
+		d.strict = true
+	}
+}
+
+// NewDecoder - a Decoder reading from r
+func NewDecoder(r io.Reader, opts ...DecodeOption) *Decoder {
+	return newDecoder(json.NewDecoder(r), opts)
+}
+
+// Unmarshal - json.Unmarshal with the options of a Decoder
+func Unmarshal(b []byte, v interface{}, opts ...DecodeOption) error {
+	if err := json.Unmarshal(b, v); err != nil {
+		return err
+	}
+	return newDecoder(nil, opts).check(v)
+}
+
+// Decode - the next json value into v, in strict mode the first unknown
+// value in it is an error
+func (d *Decoder) Decode(v interface{}) error {
+	if err := d.Decoder.Decode(v); err != nil {
+		return err
+	}
+	return d.check(v)
+}
+
+func newDecoder(dec *json.Decoder, opts []DecodeOption) *Decoder {
+	d := &Decoder{Decoder: dec}
+	for _, opt := range opts {
+		opt(d)
+	}
+	return d
+}
+
+func (d *Decoder) check(v interface{}) error {
+	if !d.strict {
+		return nil
+	}
+	return checkEnums(reflect.ValueOf(v))
+}
+
+// checkEnums - the first unknown value of an enum type in v, looking through
+// pointers, interfaces, the exported fields of structs, slices and maps
+func checkEnums(v reflect.Value) error {
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return nil
+		}
+		return checkEnums(v.Elem())
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			if len(v.Type().Field(i).PkgPath) > 0 {
+				continue
+			}
+			if err := checkEnums(v.Field(i)); err != nil {
+				return err
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			if err := checkEnums(v.Index(i)); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		iter := v.MapRange()
+		for iter.Next() {
+			if err := checkEnums(iter.Value()); err != nil {
+				return err
+			}
+		}
+	case reflect.String:
+		if e, ok := v.Interface().(enum); ok && v.Len() > 0 && !e.Valid() {
+			return &UnknownValueError{Kind: e.kind(), Value: v.String()}
+		}
+	}
+	return nil
+}
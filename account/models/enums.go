@@ -0,0 +1,190 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+type (
+	// Classification - whether an account is personal or business
+	Classification string
+
+	// BankIDCode - the scheme the bank id is in, e.g. GBDSC for uk sort codes
+	BankIDCode string
+
+	// UnknownValueError - a value that isn't one of the known constants,
+	// found by Attributes.Validate or a strict Decoder
+	UnknownValueError struct {
+		Kind  string
+		Value string
+	}
+)
+
+// Account classifications
+const (
+	ClassificationPersonal Classification = "Personal"
+	ClassificationBusiness Classification = "Business"
+)
+
+// Bank id codes, one per supported country
+const (
+	BankIDCodeAUBSB BankIDCode = "AUBSB"
+	BankIDCodeBE    BankIDCode = "BE"
+	BankIDCodeCACPA BankIDCode = "CACPA"
+	BankIDCodeCHBCC BankIDCode = "CHBCC"
+	BankIDCodeDEBLZ BankIDCode = "DEBLZ"
+	BankIDCodeESNCC BankIDCode = "ESNCC"
+	BankIDCodeFR    BankIDCode = "FR"
+	BankIDCodeGBDSC BankIDCode = "GBDSC"
+	BankIDCodeGRBIC BankIDCode = "GRBIC"
+	BankIDCodeHKNCC BankIDCode = "HKNCC"
+	BankIDCodeITNCC BankIDCode = "ITNCC"
+	BankIDCodeLULUX BankIDCode = "LULUX"
+	BankIDCodePLKNR BankIDCode = "PLKNR"
+	BankIDCodePTNCC BankIDCode = "PTNCC"
+	BankIDCodeUSABA BankIDCode = "USABA"
+)
+
+var (
+	classifications = map[Classification]bool{
+		ClassificationPersonal: true,
+		ClassificationBusiness: true,
+	}
+
+	bankIDCodes = map[BankIDCode]bool{
+		BankIDCodeAUBSB: true,
+		BankIDCodeBE:    true,
+		BankIDCodeCACPA: true,
+		BankIDCodeCHBCC: true,
+		BankIDCodeDEBLZ: true,
+		BankIDCodeESNCC: true,
+		BankIDCodeFR:    true,
+		BankIDCodeGBDSC: true,
+		BankIDCodeGRBIC: true,
+		BankIDCodeHKNCC: true,
+		BankIDCodeITNCC: true,
+		BankIDCodeLULUX: true,
+		BankIDCodePLKNR: true,
+		BankIDCodePTNCC: true,
+		BankIDCodeUSABA: true,
+	}
+)
+
+func (e *UnknownValueError) Error() string {
+	return fmt.Sprintf("unknown %s %q", e.Kind, e.Value)
+}
+
+// Valid - whether c is a known classification
+func (c Classification) Valid() bool {
+	return classifications[c]
+}
+
+func (c Classification) kind() string {
+	return "classification"
+}
+
+// MarshalJSON - c as a json string, unknown classifications included
+func (c Classification) MarshalJSON() ([]byte, error) {
+	return json.Marshal(string(c))
+}
+
+// UnmarshalJSON - a json string or null, unknown classifications are kept and only
+// rejected by a Decoder with StrictDecoding
+func (c *Classification) UnmarshalJSON(b []byte) error {
+	s, err := unmarshalEnum(b, c.kind())
+	*c = Classification(s)
+	return err
+}
+
+// Valid - whether c is a known bank id code
+func (c BankIDCode) Valid() bool {
+	return bankIDCodes[c]
+}
+
+func (c BankIDCode) kind() string {
+	return "bank id code"
+}
+
+// MarshalJSON - c as a json string, unknown bank id codes included
+func (c BankIDCode) MarshalJSON() ([]byte, error) {
+	return json.Marshal(string(c))
+}
+
+// UnmarshalJSON - a json string or null, unknown bank id codes are kept and only
+// rejected by a Decoder with StrictDecoding
+func (c *BankIDCode) UnmarshalJSON(b []byte) error {
+	s, err := unmarshalEnum(b, c.kind())
+	*c = BankIDCode(s)
+	return err
+}
+
+// Valid - whether c is an ISO 3166-1 alpha-2 country code
+func (c Country) Valid() bool {
+	return countries[c]
+}
+
+func (c Country) kind() string {
+	return "country"
+}
+
+// MarshalJSON - c as a json string, unknown countries included
+func (c Country) MarshalJSON() ([]byte, error) {
+	return json.Marshal(string(c))
+}
+
+// UnmarshalJSON - a json string or null, unknown countries are kept and only
+// rejected by a Decoder with StrictDecoding
+func (c *Country) UnmarshalJSON(b []byte) error {
+	s, err := unmarshalEnum(b, c.kind())
+	*c = Country(s)
+	return err
+}
+
+// Valid - whether c is an ISO 4217 currency code
+func (c Currency) Valid() bool {
+	return currencies[c]
+}
+
+func (c Currency) kind() string {
+	return "currency"
+}
+
+// MarshalJSON - c as a json string, unknown currencies included
+func (c Currency) MarshalJSON() ([]byte, error) {
+	return json.Marshal(string(c))
+}
+
+// UnmarshalJSON - a json string or null, unknown currencies are kept and only
+// rejected by a Decoder with StrictDecoding
+func (c *Currency) UnmarshalJSON(b []byte) error {
+	s, err := unmarshalEnum(b, c.kind())
+	*c = Currency(s)
+	return err
+}
+
+// Validate - checks the classification, country, currency and bank id code
+// are known values, empty ones are left for the account api to judge
+func (a Attributes) Validate() error {
+	switch {
+	case len(a.AccountClassification) > 0 && !a.AccountClassification.Valid():
+		return &UnknownValueError{Kind: "classification", Value: string(a.AccountClassification)}
+	case len(a.Country) > 0 && !a.Country.Valid():
+		return &UnknownValueError{Kind: "country", Value: string(a.Country)}
+	case len(a.BaseCurrency) > 0 && !a.BaseCurrency.Valid():
+		return &UnknownValueError{Kind: "currency", Value: string(a.BaseCurrency)}
+	case len(a.BankIDCode) > 0 && !a.BankIDCode.Valid():
+		return &UnknownValueError{Kind: "bank id code", Value: string(a.BankIDCode)}
+	}
+	return nil
+}
+
+func unmarshalEnum(b []byte, kind string) (string, error) {
+	var s *string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return "", fmt.Errorf("%s must be a string, got %s", kind, b)
+	}
+	if s == nil {
+		return "", nil
+	}
+	return *s, nil
+}
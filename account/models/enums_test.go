@@ -0,0 +1,53 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestStrictDecodingRejectsUnknownValues(t *testing.T) {
+	for _, tc := range []struct {
+		json, kind, value string
+	}{
+		{`{"account_classification":"personal"}`, "classification", "personal"},
+		{`{"country":"UK"}`, "country", "UK"},
+		{`{"base_currency":"XYZ"}`, "currency", "XYZ"},
+		{`{"bank_id_code":"GBSC"}`, "bank id code", "GBSC"},
+	} {
+		var attr Attributes
+		if err := json.Unmarshal([]byte(tc.json), &attr); err != nil {
+			t.Errorf("Unmarshal of %s failed with error: %v, expected the value as is", tc.json, err)
+		}
+
+		var unknown *UnknownValueError
+		err := Unmarshal([]byte(tc.json), &attr, StrictDecoding())
+		if !errors.As(err, &unknown) || unknown.Kind != tc.kind || unknown.Value != tc.value {
+			t.Errorf("strict Unmarshal of %s returned %v, expected an unknown %s error", tc.json, err, tc.kind)
+		}
+
+		var accounts []Account
+		err = NewDecoder(strings.NewReader(`[{"attributes":`+tc.json+`}]`), StrictDecoding()).Decode(&accounts)
+		if !errors.As(err, &unknown) || unknown.Kind != tc.kind {
+			t.Errorf("strict Decode of an account with %s returned %v, expected an unknown %s error", tc.json, err, tc.kind)
+		}
+	}
+
+	var attr Attributes
+	known := `{"account_classification":"Personal","country":"GB","base_currency":"GBP","bank_id_code":"GBDSC"}`
+	if err := Unmarshal([]byte(known), &attr, StrictDecoding()); err != nil {
+		t.Errorf("strict Unmarshal of known values failed with error: %v", err)
+	}
+	if err := Unmarshal([]byte(`{"country":""}`), &attr, StrictDecoding()); err != nil {
+		t.Errorf("strict Unmarshal of an empty country failed with error: %v", err)
+	}
+	if err := json.Unmarshal([]byte(`{"country":44}`), &attr); err == nil || !strings.Contains(err.Error(), "country must be a string") {
+		t.Errorf("Unmarshal of a numeric country returned %v, expected it rejected", err)
+	}
+
+	b, err := json.Marshal(Attributes{Country: "UK", BaseCurrency: CurrencyGBP})
+	if err != nil || !strings.Contains(string(b), `"country":"UK"`) || !strings.Contains(string(b), `"base_currency":"GBP"`) {
+		t.Errorf("Marshal returned %s, %v, expected the values as is", b, err)
+	}
+}
@@ -0,0 +1,67 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// TimestampLayout - RFC 3339 with milliseconds, the format the account api
+// sends created_on and modified_on in
+const TimestampLayout = "2006-01-02T15:04:05.000Z07:00"
+
+// Timestamp - a time the account api sent, encoded back exactly as it
+// arrived until Time is changed. The zero Timestamp is left out of account
+// requests
+type Timestamp struct {
+	time.Time
+
+	// raw - the text Time was parsed from, with parsed to tell if Time has
+	// changed since
+	raw    string
+	parsed time.Time
+}
+
+// ParseTimestamp - parses an RFC 3339 timestamp, the fractional seconds are
+// optional
+func ParseTimestamp(s string) (Timestamp, error) {
+	t, err := time.Parse(time.RFC3339Nano, s)
+	if err != nil {
+		return Timestamp{Time: t}, err
+	}
+	return Timestamp{Time: t, raw: s, parsed: t}, nil
+}
+
+// String - the timestamp in TimestampLayout
+func (t Timestamp) String() string {
+	return t.Format(TimestampLayout)
+}
+
+// MarshalJSON - the text the timestamp was parsed from, or TimestampLayout
+// once Time has changed. null when it's zero
+func (t Timestamp) MarshalJSON() ([]byte, error) {
+	if t.IsZero() {
+		return []byte("null"), nil
+	}
+	if len(t.raw) > 0 && t.Time.Equal(t.parsed) && t.Location() == t.parsed.Location() {
+		return json.Marshal(t.raw)
+	}
+	return json.Marshal(t.String())
+}
+
+// UnmarshalJSON - accepts RFC 3339 timestamps, null and "" leave it zero
+func (t *Timestamp) UnmarshalJSON(b []byte) error {
+	var s *string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	if s == nil || len(*s) == 0 {
+		*t = Timestamp{}
+		return nil
+	}
+	parsed, err := ParseTimestamp(*s)
+	if err != nil {
+		return err
+	}
+	*t = parsed
+	return nil
+}
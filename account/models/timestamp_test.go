@@ -0,0 +1,30 @@
+package models
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestTimestampRoundTrip(t *testing.T) {
+	in := `"2020-08-25T21:24:39.123456+02:00"`
+	var ts Timestamp
+	if err := json.Unmarshal([]byte(in), &ts); err != nil {
+		t.Fatalf("Unmarshal failed with error: %v", err)
+	}
+	if want := time.Date(2020, 8, 25, 19, 24, 39, 123456000, time.UTC); !ts.Equal(want) {
+		t.Errorf("Unmarshal of %s returned %v, expected %v", in, ts.Time, want)
+	}
+	if b, err := json.Marshal(ts); err != nil || string(b) != in {
+		t.Errorf("Marshal returned %s, %v, expected %s as it arrived", b, err, in)
+	}
+
+	ts.Time = ts.Add(time.Second)
+	if b, _ := json.Marshal(ts); string(b) != `"2020-08-25T21:24:40.123+02:00"` {
+		t.Errorf("Marshal of a changed timestamp returned %s, expected it in TimestampLayout", b)
+	}
+	ts.Time = ts.Add(-time.Second).UTC()
+	if b, _ := json.Marshal(ts); string(b) != `"2020-08-25T19:24:39.123Z"` {
+		t.Errorf("Marshal of a timestamp moved to UTC returned %s, expected it in TimestampLayout", b)
+	}
+}
@@ -0,0 +1,348 @@
+// Package modulus - Vocalink modulus checking of UK sort code and account
+// number pairs. The weight table (valacdos.txt) and sort code substitution
+// table (scsubtab.txt) are published by Vocalink and loaded from files so
+// they can be updated without a release
+package modulus
+
+import (
+	"account/models"
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Methods a sort code range is checked with
+const (
+	MOD10 Method = "MOD10"
+	MOD11 Method = "MOD11"
+	DBLAL Method = "DBLAL"
+)
+
+// positions of the digits in the 14 digit sort code and account number,
+// named as in the Vocalink specification
+const (
+	u = iota
+	v
+	w
+	x
+	y
+	z
+	a
+	b
+	c
+	d
+	e
+	f
+	g
+	h
+)
+
+var (
+	// ErrInvalid - the sort code and account number fail the modulus check
+	ErrInvalid = errors.New("sort code and account number fail the modulus check")
+
+	// ErrFormat - the sort code isn't 6 digits or the account number 8
+	ErrFormat = errors.New("sort code must be 6 digits and account number 8 digits")
+)
+
+type (
+	// Method - how the weighted digits are totalled and checked
+	Method string
+
+	// Rule - a line of the weight table, the check made for sort codes from
+	// From to To inclusive
+	Rule struct {
+		From      string
+		To        string
+		Method    Method
+		Weights   [14]int
+		Exception int
+	}
+
+	// Checker - checks sort code and account number pairs against a weight
+	// table. It's safe for concurrent use once loaded
+	Checker struct {
+		rules         []Rule
+		substitutions map[string]string
+	}
+
+	digits [14]int
+)
+
+// Load - reads a weight table in the valacdos.txt format, one rule a line:
+// from, to, method, 14 weights and an optional exception number
+func Load(r io.Reader) (*Checker, error) {
+	ch := &Checker{substitutions: map[string]string{}}
+	err := scanLines(r, func(n int, fields []string) error {
+		rule, err := parseRule(fields)
+		if err != nil {
+			return fmt.Errorf("weight table line %d: %v", n, err)
+		}
+		ch.rules = append(ch.rules, rule)
+		return nil
+	})
+	return ch, err
+}
+
+// LoadFile - Load from the file at path
+func LoadFile(path string) (*Checker, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return Load(f)
+}
+
+// LoadSubstitutions - reads a sort code substitution table in the
+// scsubtab.txt format, one original and substitute sort code a line. Used
+// by the exception 5 checks
+func (ch *Checker) LoadSubstitutions(r io.Reader) error {
+	return scanLines(r, func(n int, fields []string) error {
+		if len(fields) < 2 || !isDigits(fields[0], 6) || !isDigits(fields[1], 6) {
+			return fmt.Errorf("substitution table line %d: expected two sort codes", n)
+		}
+		ch.substitutions[fields[0]] = fields[1]
+		return nil
+	})
+}
+
+// LoadSubstitutionsFile - LoadSubstitutions from the file at path
+func (ch *Checker) LoadSubstitutionsFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return ch.LoadSubstitutions(f)
+}
+
+// Validate - checks the sort code and account number of GB accounts, other
+// accounts and ones without an account number (the account api generates
+// one) pass
+func (ch *Checker) Validate(acc models.Account) error {
+	attr := acc.Attributes
+	if attr.Country != models.CountryGB || len(attr.AccountNumber) == 0 {
+		return nil
+	}
+	return ch.Check(attr.BankID, attr.AccountNumber)
+}
+
+// Check - nil when the pair passes, or when the sort code isn't in the
+// weight table and so can't be checked. Sort codes may contain dashes
+func (ch *Checker) Check(sortCode, accountNumber string) error {
+	sortCode = strings.Replace(sortCode, "-", "", -1)
+	if !isDigits(sortCode, 6) || !isDigits(accountNumber, 8) {
+		return ErrFormat
+	}
+	if ch.valid(sortCode, accountNumber) {
+		return nil
+	}
+	return fmt.Errorf("%s %s: %w", sortCode, accountNumber, ErrInvalid)
+}
+
+func (ch *Checker) valid(sortCode, accountNumber string) bool {
+	n := toDigits(sortCode + accountNumber)
+	rules := ch.lookup(sortCode)
+	if len(rules) == 0 {
+		return true
+	}
+
+	for _, r := range rules {
+		// foreign currency accounts can't be checked
+		if r.Exception == 6 && n[a] >= 4 && n[a] <= 8 && n[g] == n[h] {
+			return true
+		}
+	}
+
+	if len(rules) == 1 {
+		return ch.check(rules[0], n)
+	}
+
+	first, second := rules[0], rules[1]
+	switch {
+	case first.Exception == 2 && second.Exception == 9,
+		first.Exception == 10 && second.Exception == 11,
+		first.Exception == 12 && second.Exception == 13:
+		// either check passing is enough
+		return ch.check(first, n) || ch.check(second, n)
+	case second.Exception == 3 && (n[c] == 6 || n[c] == 9):
+		return ch.check(first, n)
+	}
+	return ch.check(first, n) && ch.check(second, n)
+}
+
+// lookup - the rules for sortCode, there are at most two
+func (ch *Checker) lookup(sortCode string) []Rule {
+	var rules []Rule
+	for _, r := range ch.rules {
+		if r.From <= sortCode && sortCode <= r.To {
+			rules = append(rules, r)
+		}
+	}
+	return rules
+}
+
+func (ch *Checker) check(r Rule, n digits) bool {
+	weights := r.Weights
+	switch r.Exception {
+	case 2:
+		if n[a] != 0 && n[g] != 9 {
+			weights = [14]int{0, 0, 1, 2, 5, 3, 6, 4, 8, 7, 10, 9, 3, 1}
+		} else if n[a] != 0 {
+			weights = [14]int{0, 0, 0, 0, 0, 0, 0, 0, 8, 7, 10, 9, 3, 1}
+		}
+	case 5:
+		if sub, ok := ch.substitutions[sortCodeOf(n)]; ok {
+			n = replaceSortCode(n, sub)
+		}
+	case 7:
+		if n[g] == 9 {
+			zeroUToB(&weights)
+		}
+	case 8:
+		n = replaceSortCode(n, "090126")
+	case 9:
+		n = replaceSortCode(n, "309634")
+	case 10:
+		if (n[a] == 0 || n[a] == 9) && n[b] == 9 && n[g] == 9 {
+			zeroUToB(&weights)
+		}
+	}
+
+	total := weigh(r.Method, n, weights)
+	if r.Exception == 1 {
+		total += 27
+	}
+
+	switch r.Method {
+	case MOD11:
+		rem := total % 11
+		switch r.Exception {
+		case 4:
+			return rem == n[g]*10+n[h]
+		case 5:
+			return rem == 0 && n[g] == 0 || rem > 1 && 11-rem == n[g]
+		case 14:
+			if rem == 0 {
+				return true
+			}
+			if n[h] != 0 && n[h] != 1 && n[h] != 9 {
+				return false
+			}
+			// the last digit is dropped and the rest shifted right
+			shifted := n
+			copy(shifted[b:], n[a:h])
+			shifted[a] = 0
+			return weigh(r.Method, shifted, weights)%11 == 0
+		}
+		return rem == 0
+	default:
+		rem := total % 10
+		if r.Exception == 5 {
+			return rem == 0 && n[h] == 0 || rem > 0 && 10-rem == n[h]
+		}
+		return rem == 0
+	}
+}
+
+// weigh - the total of the digits times their weights, for DBLAL it's the
+// total of the digits of the products
+func weigh(m Method, n digits, weights [14]int) int {
+	total := 0
+	for i := range n {
+		p := n[i] * weights[i]
+		if m == DBLAL {
+			p = p/10 + p%10
+		}
+		total += p
+	}
+	return total
+}
+
+func parseRule(fields []string) (Rule, error) {
+	if len(fields) < 17 {
+		return Rule{}, fmt.Errorf("expected at least 17 fields, got %d", len(fields))
+	}
+	r := Rule{From: fields[0], To: fields[1], Method: Method(fields[2])}
+	if !isDigits(r.From, 6) || !isDigits(r.To, 6) {
+		return r, fmt.Errorf("invalid sort code range %s %s", r.From, r.To)
+	}
+	if r.Method != MOD10 && r.Method != MOD11 && r.Method != DBLAL {
+		return r, fmt.Errorf("unknown method %s", r.Method)
+	}
+	for i := range r.Weights {
+		weight, err := strconv.Atoi(fields[3+i])
+		if err != nil {
+			return r, fmt.Errorf("invalid weight %s", fields[3+i])
+		}
+		r.Weights[i] = weight
+	}
+	if len(fields) > 17 {
+		exception, err := strconv.Atoi(fields[17])
+		if err != nil {
+			return r, fmt.Errorf("invalid exception %s", fields[17])
+		}
+		r.Exception = exception
+	}
+	return r, nil
+}
+
+// scanLines - calls fn with the fields of each non blank line
+func scanLines(r io.Reader, fn func(n int, fields []string) error) error {
+	s := bufio.NewScanner(r)
+	for n := 1; s.Scan(); n++ {
+		fields := strings.Fields(s.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		if err := fn(n, fields); err != nil {
+			return err
+		}
+	}
+	return s.Err()
+}
+
+func isDigits(s string, length int) bool {
+	if len(s) != length {
+		return false
+	}
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+func toDigits(s string) digits {
+	var n digits
+	for i := range n {
+		n[i] = int(s[i] - '0')
+	}
+	return n
+}
+
+func sortCodeOf(n digits) string {
+	var sb strings.Builder
+	for _, d := range n[u:a] {
+		sb.WriteByte(byte('0' + d))
+	}
+	return sb.String()
+}
+
+func replaceSortCode(n digits, sortCode string) digits {
+	sc := toDigits(sortCode + "00000000")
+	copy(n[u:a], sc[u:a])
+	return n
+}
+
+func zeroUToB(weights *[14]int) {
+	for i := u; i <= b; i++ {
+		weights[i] = 0
+	}
+}
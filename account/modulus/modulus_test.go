@@ -0,0 +1,110 @@
+package modulus
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+// weights - the rules for the sort codes of the Vocalink test vectors
+const weights = `
+089000 089999 MOD10    0    0    0    0    0    0    7    1    3    7    1    3    7    1
+107000 107999 MOD11    0    0    0    0    0    0    8    7    6    5    4    3    2    1
+118765 118765 DBLAL    0    0    2    1    2    1    2    1    2    1    2    1    2    1    1
+134012 134020 MOD11    0    0    0    7    5    9    8    4    6    3    5    2    0    0    4
+180002 180002 MOD11    0    0    0    0    0    0    8    7    6    5    4    3    2    1   14
+200915 200915 MOD11    2    7    6    5    4    3    2    7    6    5    4    3    2    1    6
+200915 200915 DBLAL    2    1    2    1    2    1    2    1    2    1    2    1    2    1    6
+202959 203099 MOD11    0    0    0    0    0    0    0    7    6    5    4    3    2    1
+202959 203099 DBLAL    2    1    2    1    2    1    2    1    2    1    2    1    2    1
+309070 309070 MOD11    6    5    4    3    2    9    8    7    6    5    4    3    2    1    2
+309070 309070 MOD11    0    7    6    5    4    3    2    7    6    5    4    3    2    1    9
+772798 772798 MOD11    0    0    1    2    5    3    6    4    8    7   10    9    3    1    7
+820000 826999 MOD11    0    0    1    2    5    3    6    4    8    7   10    9    3    1
+820000 826999 DBLAL    2    1    2    1    2    1    2    1    2    1    2    1    2    1    3
+827000 827999 MOD11    0    0    0    4    3    2    7    6    5    4    3    2    1    0
+827000 827999 DBLAL    2    1    2    1    2    1    2    1    2    1    2    1    2    1    3
+871427 872427 MOD11    0    0    1    2    5    3    6    4    8    7   10    9    3    1   10
+871427 872427 MOD11    0    6    5    4    3    2    7    6    5    4    3    2    1    0   11
+070116 074456 MOD11    0    0    0    0    0    3    2    7    6    5    4    3    2    1   12
+070116 074456 DBLAL    0    0    0    2    1    2    1    2    1    2    1    2    1    2   13
+086086 086090 MOD11    0    0    0    0   10    9    8    7    6    5    4    3    2    1    8
+938000 938696 MOD11    7    6    5    4    3    2    7    6    5    4    3    2    0    0    5
+938000 938696 DBLAL    2    1    2    1    2    1    2    1    2    1    2    1    0    0    5
+`
+
+// substitutions - the sort codes the exception 5 test vectors are checked as
+const substitutions = `
+938600 938611
+938611 938088
+`
+
+func TestCheck(t *testing.T) {
+	t.Parallel()
+	checker, err := Load(strings.NewReader(weights))
+	if err != nil {
+		t.Fatalf("Load failed with error: %v", err)
+	}
+	if err := checker.LoadSubstitutions(strings.NewReader(substitutions)); err != nil {
+		t.Fatalf("LoadSubstitutions failed with error: %v", err)
+	}
+
+	// the published Vocalink test vectors, with failing ones added where
+	// there are none for an algorithm or exception
+	tests := []struct {
+		name                    string
+		sortCode, accountNumber string
+		want                    error
+	}{
+		{"modulus 10", "08-99-99", "66374958", nil},
+		{"modulus 10 fails", "089999", "66374959", ErrInvalid},
+		{"modulus 11", "107999", "88837491", nil},
+		{"modulus 11 fails", "107999", "88837493", ErrInvalid},
+		{"modulus 11 and double alternate", "202959", "63748472", nil},
+		{"modulus 11 passes and double alternate fails", "203099", "66831036", ErrInvalid},
+		{"modulus 11 fails and double alternate passes", "203099", "58716970", ErrInvalid},
+		{"exception 1 adds 27", "118765", "64371389", nil},
+		{"exception 1 fails", "118765", "64371388", ErrInvalid},
+		{"exception 2 and 9, the first check passes", "309070", "02355688", nil},
+		{"exception 2 and 9, the second check passes", "309070", "12345668", nil},
+		{"exception 2 where a isn't 0 and g isn't 9", "309070", "12345677", nil},
+		{"exception 2 where a isn't 0 and g is 9", "309070", "99345694", nil},
+		{"exception 2 and 9 fail", "309070", "12345678", ErrInvalid},
+		{"exception 3 where c isn't 6 or 9", "827101", "28748352", nil},
+		{"exception 3 where c is 6", "820000", "73688637", nil},
+		{"exception 3 where c is 9", "827999", "73988638", nil},
+		{"exception 3 fails", "827101", "28748353", ErrInvalid},
+		{"exception 4, the remainder is gh", "134020", "63849203", nil},
+		{"exception 4 fails", "134020", "63849204", ErrInvalid},
+		{"exception 5, the check digits are right", "938611", "07806039", nil},
+		{"exception 5 with a substituted sort code", "938600", "42368003", nil},
+		{"exception 5, both remainders are 0", "938063", "55065200", nil},
+		{"exception 5, the second check digit is wrong", "938063", "15764273", ErrInvalid},
+		{"exception 5, the first check digit is wrong", "938063", "15764264", ErrInvalid},
+		{"exception 5, the first remainder is 1", "938063", "15763217", ErrInvalid},
+		{"exception 6, a foreign currency account", "200915", "41011166", nil},
+		{"exception 6 fails", "200915", "41011165", ErrInvalid},
+		{"exception 7 where g is 9", "772798", "99345694", nil},
+		{"exception 7 fails", "772798", "99345695", ErrInvalid},
+		{"exception 8", "086090", "06774744", nil},
+		{"exception 8 fails", "086090", "06774745", ErrInvalid},
+		{"exception 10 and 11, the first check passes", "871427", "46238510", nil},
+		{"exception 10 and 11, the second check passes", "872427", "46238510", nil},
+		{"exception 10 where ab is 09 and g is 9", "871427", "09123496", nil},
+		{"exception 10 where ab is 99 and g is 9", "871427", "99123496", nil},
+		{"exception 10 and 11 fail", "871427", "46238511", ErrInvalid},
+		{"exception 12 and 13, modulus 11 passes", "074456", "12345112", nil},
+		{"exception 12 and 13, modulus 11 passes", "070116", "34012583", nil},
+		{"exception 12 and 13, only the second check passes", "074456", "11104102", nil},
+		{"exception 12 and 13 fail", "074456", "11104104", ErrInvalid},
+		{"exception 14, the shifted account number passes", "180002", "00000190", nil},
+		{"exception 14 fails", "180002", "00000192", ErrInvalid},
+		{"sort code not in the table", "200000", "12345678", nil},
+		{"short sort code", "10799", "88837491", ErrFormat},
+	}
+	for _, tt := range tests {
+		if err := checker.Check(tt.sortCode, tt.accountNumber); !errors.Is(err, tt.want) {
+			t.Errorf("%s: Check(%s, %s) returned %v, expected %v", tt.name, tt.sortCode, tt.accountNumber, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package account
+
+import (
+	"account/infrastructure"
+	"account/tracing"
+	"context"
+	"time"
+)
+
+// Option - configures optional behaviour of the Service
+type Option func(s *Service)
+
+// WithTracer - trace every operation with t, each operation gets a span
+// carrying the operation, account id, status, retries and error
+func WithTracer(t tracing.Tracer) Option {
+	return func(s *Service) {
+		s.tracer = t
+	}
+}
+
+// WithRetries - retry creates that fail with a transport error, 5xx or 429
+// up to attempts times in total, waiting backoff before the first retry and
+// doubling it each time. Creates are only retried with the same
+// Idempotency-Key so the account api can tell it's the same request
+func WithRetries(attempts int, backoff time.Duration) Option {
+	return func(s *Service) {
+		if attempts < 1 {
+			attempts = 1
+		}
+		s.attempts = attempts
+		s.backoff = backoff
+	}
+}
+
+// WithDuplicateRecovery - when a create is refused because the id already
+// exists, fetch the existing account and return it if it matches the one
+// being created (same organisation and attributes). Together with retries
+// this makes Create exactly-once from the caller's point of view
+func WithDuplicateRecovery() Option {
+	return func(s *Service) {
+		s.recoverDuplicates = true
+	}
+}
+
+// WithoutIDGeneration - make Create fail on accounts without an ID instead
+// of generating a random (v4) uuid for them
+func WithoutIDGeneration() Option {
+	return func(s *Service) {
+		s.generateIDs = false
+	}
+}
+
+// WithOrganisationID - the organisation accounts are created in when they
+// don't name one themselves
+func WithOrganisationID(id string) Option {
+	return func(s *Service) {
+		s.organisationID = id
+	}
+}
+
+// WithValidator - run v on every account before Create sends it, Create
+// fails with v's error
+func WithValidator(v Validator) Option {
+	return func(s *Service) {
+		s.validators = append(s.validators, v)
+	}
+}
+
+// WithStrictEnums - reject classifications, countries, currencies and bank
+// id codes that aren't known values with a *models.UnknownValueError, both in
+// the accounts Create sends and in the accounts the account api returns.
+// Without it they're passed through as is, so values the account api adds
+// later still work
+func WithStrictEnums() Option {
+	return func(s *Service) {
+		s.strictEnums = true
+	}
+}
+
+// startSpan - starts the span an operation runs under, the returned context
+// also names the operation for the metrics recorded by infrastructure.HTTP
+func (s *Service) startSpan(ctx context.Context, operation, id string) (context.Context, tracing.Span) {
+	ctx, span := s.tracer.Start(ctx, "account."+operation)
+	span.SetAttribute("account.operation", operation)
+	if len(id) > 0 {
+		span.SetAttribute("account.id", id)
+	}
+	return infrastructure.WithOperation(ctx, operation), span
+}
+
+func endSpan(span tracing.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetAttribute("error", true)
+	}
+	span.End()
+}
@@ -0,0 +1,237 @@
+// Package reconcile - compares the accounts a ledger expects with those the
+// account api has, and optionally makes the account api match
+package reconcile
+
+import (
+	"account"
+	"account/bulk"
+	"account/models"
+	"account/snapshot"
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+)
+
+const defaultPageSize = 100
+
+type (
+	// Source - calls fn with each expected account, stopping at the first
+	// error fn returns
+	Source func(fn func(models.Account) error) error
+
+	// Reconciler - reconciles the accounts of Service with an expected set.
+	// It only reports unless Apply is set
+	Reconciler struct {
+		Service *account.Service
+		// OrganisationID - when set, only accounts in this organisation are
+		// compared, others in the account api are left alone
+		OrganisationID string
+		// Apply - create the missing accounts and delete the unexpected ones
+		Apply bool
+		// PageSize - accounts fetched at a time, defaults to 100
+		PageSize int
+	}
+
+	// Report - the outcome of a Run, each list sorted by id
+	Report struct {
+		DryRun     bool             `json:"dry_run"`
+		Missing    []models.Account `json:"missing"`
+		Unexpected []models.Account `json:"unexpected"`
+		Mismatched []Mismatch       `json:"mismatched"`
+		// Created, Deleted - ids of the accounts changed when applying
+		Created []string `json:"created"`
+		Deleted []string `json:"deleted"`
+		Errors  []string `json:"errors"`
+	}
+
+	// Mismatch - an account in both with different organisations or
+	// attributes
+	Mismatch struct {
+		ID     string                 `json:"id"`
+		Fields []snapshot.FieldChange `json:"fields"`
+	}
+)
+
+// FromSlice - a Source of accounts
+func FromSlice(accounts []models.Account) Source {
+	return func(fn func(models.Account) error) error {
+		for _, a := range accounts {
+			if err := fn(a); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// FromReader - a Source of the rows of an import file, a row that can't be
+// read stops the reconcile since the expected set would be incomplete
+func FromReader(r *bulk.Reader) Source {
+	return func(fn func(models.Account) error) error {
+		for {
+			rec, err := r.Next()
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			if err := fn(rec.Account); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// FromSnapshot - a Source of the accounts in a snapshot
+func FromSnapshot(s *snapshot.Snapshot) Source {
+	return func(fn func(models.Account) error) error {
+		for _, a := range s.Accounts {
+			if err := fn(a); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// Run - walks the account api's accounts against expected. The error is for
+// expected or the account api failing, ids expected more than once and
+// failures to create or delete while applying are in Report.Errors
+func (r *Reconciler) Run(ctx context.Context, expected Source) (*Report, error) {
+	report := &Report{
+		DryRun:     !r.Apply,
+		Missing:    []models.Account{},
+		Unexpected: []models.Account{},
+		Mismatched: []Mismatch{},
+		Created:    []string{},
+		Deleted:    []string{},
+		Errors:     []string{},
+	}
+	want := map[string]models.Account{}
+	err := expected(func(a models.Account) error {
+		if len(a.ID) == 0 {
+			return errors.New("expected accounts need an id to be reconciled")
+		}
+		if _, ok := want[a.ID]; ok {
+			// which of them is right can't be told, so the first is kept
+			report.Errors = append(report.Errors, fmt.Sprintf("%s is expected more than once, only the first is reconciled", a.ID))
+			return nil
+		}
+		if len(r.OrganisationID) > 0 && len(a.OrganisationID) == 0 {
+			a.OrganisationID = r.OrganisationID
+		}
+		want[a.ID] = a
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	pageSize := r.PageSize
+	if pageSize <= 0 {
+		pageSize = defaultPageSize
+	}
+	seen := map[string]bool{}
+	err = r.Service.WalkContext(ctx, pageSize, func(got models.Account) error {
+		if len(r.OrganisationID) > 0 && got.OrganisationID != r.OrganisationID {
+			return nil
+		}
+		seen[got.ID] = true
+		exp, ok := want[got.ID]
+		if !ok {
+			report.Unexpected = append(report.Unexpected, got)
+			return nil
+		}
+		fields := snapshot.AttributeChanges(exp.Attributes, got.Attributes)
+		if exp.OrganisationID != got.OrganisationID {
+			fields = append([]snapshot.FieldChange{{Field: "organisation_id", Old: exp.OrganisationID, New: got.OrganisationID}}, fields...)
+		}
+		if len(fields) > 0 {
+			report.Mismatched = append(report.Mismatched, Mismatch{ID: got.ID, Fields: fields})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	for id, a := range want {
+		if !seen[id] {
+			report.Missing = append(report.Missing, a)
+		}
+	}
+	report.sort()
+
+	if r.Apply {
+		r.apply(ctx, report)
+	}
+	return report, nil
+}
+
+// apply - creates the missing accounts and deletes the unexpected ones,
+// mismatched accounts are left since the account api can't update them
+func (r *Reconciler) apply(ctx context.Context, report *Report) {
+	for _, a := range report.Missing {
+		if ctx.Err() != nil {
+			break
+		}
+		if _, err := r.Service.CreateContext(ctx, a); err != nil {
+			report.Errors = append(report.Errors, fmt.Sprintf("creating %s: %v", a.ID, err))
+			continue
+		}
+		report.Created = append(report.Created, a.ID)
+	}
+	for _, a := range report.Unexpected {
+		if ctx.Err() != nil {
+			break
+		}
+		if err := r.Service.DeleteContext(ctx, a.ID, a.Version); err != nil {
+			report.Errors = append(report.Errors, fmt.Sprintf("deleting %s: %v", a.ID, err))
+			continue
+		}
+		report.Deleted = append(report.Deleted, a.ID)
+	}
+	if err := ctx.Err(); err != nil {
+		report.Errors = append(report.Errors, fmt.Sprintf("stopped applying: %v", err))
+	}
+}
+
+// WriteText - the report a line an account, + missing, - unexpected and ~
+// mismatched followed by the fields that differ (expected -> actual)
+func (report *Report) WriteText(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	for _, a := range report.Missing {
+		fmt.Fprintf(bw, "+ %s missing\n", a.ID)
+	}
+	for _, a := range report.Unexpected {
+		fmt.Fprintf(bw, "- %s unexpected\n", a.ID)
+	}
+	for _, m := range report.Mismatched {
+		fmt.Fprintf(bw, "~ %s mismatched\n", m.ID)
+		for _, f := range m.Fields {
+			fmt.Fprintf(bw, "    %s: expected %q, got %q\n", f.Field, f.Old, f.New)
+		}
+	}
+	for _, e := range report.Errors {
+		fmt.Fprintf(bw, "! %s\n", e)
+	}
+	fmt.Fprintf(bw, "%d missing, %d unexpected, %d mismatched", len(report.Missing), len(report.Unexpected), len(report.Mismatched))
+	if report.DryRun {
+		fmt.Fprintln(bw, " (dry run, nothing changed)")
+	} else {
+		fmt.Fprintf(bw, ", %d created, %d deleted\n", len(report.Created), len(report.Deleted))
+	}
+	return bw.Flush()
+}
+
+func (report *Report) sort() {
+	byID := func(accounts []models.Account) {
+		sort.Slice(accounts, func(i, j int) bool { return accounts[i].ID < accounts[j].ID })
+	}
+	byID(report.Missing)
+	byID(report.Unexpected)
+	sort.Slice(report.Mismatched, func(i, j int) bool { return report.Mismatched[i].ID < report.Mismatched[j].ID })
+}
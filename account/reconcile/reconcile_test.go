@@ -0,0 +1,138 @@
+package reconcile
+
+import (
+	"account"
+	"account/infrastructure"
+	"account/models"
+	"account/snapshot"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const (
+	org   = "eb0bd6f5-c3f5-44b2-b677-acd23cdde73c"
+	other = "eb0bd6f5-c3f5-44b2-b677-acd23cdde73d"
+)
+
+func gb(id, organisationID, bankID string) models.Account {
+	a, _ := account.NewGB().ID(id).OrganisationID(organisationID).BankID(bankID).Bic("NWBKGB42").Build()
+	return a
+}
+
+func TestReconcileDryRunAndApply(t *testing.T) {
+	var mu sync.Mutex
+	stored := map[string]models.Account{}
+	for _, a := range []models.Account{
+		gb("ad27e265-9605-4b4b-a0e5-3003ea9cc4d1", org, "400302"),
+		gb("ad27e265-9605-4b4b-a0e5-3003ea9cc4d2", org, "400303"),
+		gb("ad27e265-9605-4b4b-a0e5-3003ea9cc4d4", org, "400302"),
+		gb("ad27e265-9605-4b4b-a0e5-3003ea9cc4d5", other, "400302"),
+	} {
+		stored[a.ID] = a
+	}
+	unexpected := stored["ad27e265-9605-4b4b-a0e5-3003ea9cc4d4"]
+	unexpected.Version = 2
+	stored[unexpected.ID] = unexpected
+	var changes []string
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		switch r.Method {
+		case http.MethodPost:
+			body := &struct {
+				Data models.Account `json:"data"`
+			}{}
+			json.NewDecoder(r.Body).Decode(body)
+			stored[body.Data.ID] = body.Data
+			changes = append(changes, "create "+body.Data.ID)
+			json.NewEncoder(w).Encode(body)
+		case http.MethodDelete:
+			id := path.Base(r.URL.Path)
+			delete(stored, id)
+			changes = append(changes, "delete "+id+" version "+r.URL.Query().Get("version"))
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			var list []models.Account
+			for _, a := range stored {
+				list = append(list, a)
+			}
+			sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+			json.NewEncoder(w).Encode(map[string]interface{}{"data": list})
+		}
+	})
+	s := httptest.NewServer(h)
+	defer s.Close()
+	u, _ := url.Parse(s.URL)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	service := account.NewService(infrastructure.NewHTTP(ctx, s.Client(), u, ""))
+
+	expected := FromSlice([]models.Account{
+		gb("ad27e265-9605-4b4b-a0e5-3003ea9cc4d1", org, "400302"),
+		gb("ad27e265-9605-4b4b-a0e5-3003ea9cc4d2", org, "400302"),
+		gb("ad27e265-9605-4b4b-a0e5-3003ea9cc4d3", org, "400302"),
+	})
+	r := &Reconciler{Service: service, OrganisationID: org}
+	report, err := r.Run(ctx, expected)
+	if err != nil {
+		t.Fatalf("Run failed with error: %v", err)
+	}
+	if !report.DryRun || len(report.Missing) != 1 || report.Missing[0].ID != "ad27e265-9605-4b4b-a0e5-3003ea9cc4d3" ||
+		len(report.Unexpected) != 1 || report.Unexpected[0].ID != "ad27e265-9605-4b4b-a0e5-3003ea9cc4d4" {
+		t.Errorf("Run reported %+v, expected account 3 missing and 4 unexpected", report)
+	}
+	wantMismatch := []Mismatch{{ID: "ad27e265-9605-4b4b-a0e5-3003ea9cc4d2", Fields: []snapshot.FieldChange{{Field: "bank_id", Old: "400302", New: "400303"}}}}
+	if !reflect.DeepEqual(report.Mismatched, wantMismatch) {
+		t.Errorf("Run reported mismatches %+v, expected %+v", report.Mismatched, wantMismatch)
+	}
+	if len(changes) != 0 {
+		t.Fatalf("dry run made changes %v", changes)
+	}
+
+	r.Apply = true
+	report, err = r.Run(ctx, expected)
+	want := []string{"create ad27e265-9605-4b4b-a0e5-3003ea9cc4d3", "delete ad27e265-9605-4b4b-a0e5-3003ea9cc4d4 version 2"}
+	if err != nil || !reflect.DeepEqual(changes, want) || len(report.Errors) != 0 {
+		t.Errorf("Run with Apply made changes %v (errors %v), expected %v", changes, report.Errors, want)
+	}
+	if _, ok := stored["ad27e265-9605-4b4b-a0e5-3003ea9cc4d5"]; !ok {
+		t.Error("Run with Apply deleted an account in another organisation")
+	}
+}
+
+func TestReconcileReportsDuplicateExpectedIDs(t *testing.T) {
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"data": []}`))
+	})
+	s := httptest.NewServer(h)
+	defer s.Close()
+	u, _ := url.Parse(s.URL)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	service := account.NewService(infrastructure.NewHTTP(ctx, s.Client(), u, ""))
+
+	expected := FromSlice([]models.Account{
+		gb("ad27e265-9605-4b4b-a0e5-3003ea9cc4d1", org, "400302"),
+		gb("ad27e265-9605-4b4b-a0e5-3003ea9cc4d1", org, "400303"),
+	})
+	report, err := (&Reconciler{Service: service, OrganisationID: org}).Run(ctx, expected)
+	if err != nil {
+		t.Fatalf("Run failed with error: %v", err)
+	}
+	if len(report.Missing) != 1 || report.Missing[0].Attributes.BankID != "400302" {
+		t.Errorf("Run reported %+v missing, expected only the first account", report.Missing)
+	}
+	if len(report.Errors) != 1 || !strings.Contains(report.Errors[0], "ad27e265-9605-4b4b-a0e5-3003ea9cc4d1 is expected more than once") {
+		t.Errorf("Run reported errors %v, expected the duplicate id", report.Errors)
+	}
+}
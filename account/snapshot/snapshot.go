@@ -0,0 +1,197 @@
+// Package snapshot - saves every account to a file and compares two of
+// those files, so changes between two points in time can be reported
+//
+// A snapshot is JSON Lines: a Header on the first line then an account a
+// line, as the account api sends them
+package snapshot
+
+import (
+	"account"
+	"account/models"
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Version - the snapshot format written, Read accepts it and earlier ones
+const Version = 1
+
+// maxLine - the longest line read from a snapshot
+const maxLine = 1 << 20
+
+type (
+	// Header - the first line of a snapshot
+	Header struct {
+		Version        int       `json:"snapshot_version"`
+		Taken          time.Time `json:"taken"`
+		OrganisationID string    `json:"organisation_id,omitempty"`
+	}
+
+	// Snapshot - the accounts of a snapshot by id
+	Snapshot struct {
+		Header   Header
+		Accounts map[string]models.Account
+	}
+
+	// Diff - what changed between two snapshots
+	Diff struct {
+		Added    []models.Account `json:"added"`
+		Removed  []models.Account `json:"removed"`
+		Modified []Change         `json:"modified"`
+	}
+
+	// Change - an account in both snapshots with different attributes
+	Change struct {
+		ID     string        `json:"id"`
+		Fields []FieldChange `json:"fields"`
+	}
+
+	// FieldChange - an attribute, named as in the account api's json, that
+	// changed
+	FieldChange struct {
+		Field string `json:"field"`
+		Old   string `json:"old"`
+		New   string `json:"new"`
+	}
+)
+
+// Take - writes every account (or only those in organisationID, when it's
+// set) to w, fetched pageSize at a time. Returns how many were written
+func Take(ctx context.Context, s *account.Service, w io.Writer, organisationID string, pageSize int) (int, error) {
+	bw := bufio.NewWriter(w)
+	enc := json.NewEncoder(bw)
+	err := enc.Encode(Header{Version: Version, Taken: time.Now().UTC(), OrganisationID: organisationID})
+	if err != nil {
+		return 0, err
+	}
+
+	n := 0
+	err = s.WalkContext(ctx, pageSize, func(a models.Account) error {
+		if len(organisationID) > 0 && a.OrganisationID != organisationID {
+			return nil
+		}
+		n++
+		return enc.Encode(a)
+	})
+	if err != nil {
+		return n, err
+	}
+	return n, bw.Flush()
+}
+
+// Read - reads a snapshot written by Take, decoding its accounts with opts,
+// such as models.StrictDecoding
+func Read(r io.Reader, opts ...models.DecodeOption) (*Snapshot, error) {
+	s := bufio.NewScanner(r)
+	s.Buffer(make([]byte, 64*1024), maxLine)
+	if !s.Scan() {
+		if err := s.Err(); err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("snapshot is empty")
+	}
+
+	snap := &Snapshot{Accounts: map[string]models.Account{}}
+	if err := json.Unmarshal(s.Bytes(), &snap.Header); err != nil || snap.Header.Version == 0 {
+		return nil, fmt.Errorf("snapshot header is missing")
+	}
+	if snap.Header.Version > Version {
+		return nil, fmt.Errorf("snapshot version %d is newer than %d", snap.Header.Version, Version)
+	}
+
+	for line := 2; s.Scan(); line++ {
+		if len(strings.TrimSpace(s.Text())) == 0 {
+			continue
+		}
+		var a models.Account
+		if err := models.Unmarshal(s.Bytes(), &a, opts...); err != nil {
+			return nil, fmt.Errorf("snapshot line %d: %w", line, err)
+		}
+		snap.Accounts[a.ID] = a
+	}
+	return snap, s.Err()
+}
+
+// Compare - the accounts added, removed and modified going from old to
+// new, each sorted by id
+func Compare(old, new *Snapshot) *Diff {
+	d := &Diff{Added: []models.Account{}, Removed: []models.Account{}, Modified: []Change{}}
+	for _, id := range sortedIDs(new.Accounts) {
+		before, ok := old.Accounts[id]
+		if !ok {
+			d.Added = append(d.Added, new.Accounts[id])
+			continue
+		}
+		if fields := AttributeChanges(before.Attributes, new.Accounts[id].Attributes); len(fields) > 0 {
+			d.Modified = append(d.Modified, Change{ID: id, Fields: fields})
+		}
+	}
+	for _, id := range sortedIDs(old.Accounts) {
+		if _, ok := new.Accounts[id]; !ok {
+			d.Removed = append(d.Removed, old.Accounts[id])
+		}
+	}
+	return d
+}
+
+// Empty - whether nothing changed
+func (d *Diff) Empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Modified) == 0
+}
+
+// WriteText - the diff a line an account, + added, - removed and ~ modified
+// followed by its changed fields
+func (d *Diff) WriteText(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	for _, a := range d.Added {
+		fmt.Fprintf(bw, "+ %s\n", describe(a))
+	}
+	for _, a := range d.Removed {
+		fmt.Fprintf(bw, "- %s\n", describe(a))
+	}
+	for _, c := range d.Modified {
+		fmt.Fprintf(bw, "~ %s\n", c.ID)
+		for _, f := range c.Fields {
+			fmt.Fprintf(bw, "    %s: %q -> %q\n", f.Field, f.Old, f.New)
+		}
+	}
+	fmt.Fprintf(bw, "%d added, %d removed, %d modified\n", len(d.Added), len(d.Removed), len(d.Modified))
+	return bw.Flush()
+}
+
+func describe(a models.Account) string {
+	attr := a.Attributes
+	return strings.Join(strings.Fields(fmt.Sprintf("%s %s %s %s", a.ID, attr.Country, attr.BankID, attr.AccountNumber)), " ")
+}
+
+// AttributeChanges - the attributes that differ, in the order they're
+// declared
+func AttributeChanges(old, new models.Attributes) []FieldChange {
+	var changes []FieldChange
+	ov, nv := reflect.ValueOf(old), reflect.ValueOf(new)
+	t := ov.Type()
+	for i := 0; i < t.NumField(); i++ {
+		before, after := fmt.Sprint(ov.Field(i).Interface()), fmt.Sprint(nv.Field(i).Interface())
+		if before == after {
+			continue
+		}
+		name := strings.Split(t.Field(i).Tag.Get("json"), ",")[0]
+		changes = append(changes, FieldChange{Field: name, Old: before, New: after})
+	}
+	return changes
+}
+
+func sortedIDs(accounts map[string]models.Account) []string {
+	ids := make([]string, 0, len(accounts))
+	for id := range accounts {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
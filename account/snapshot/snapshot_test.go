@@ -0,0 +1,80 @@
+package snapshot
+
+import (
+	"account"
+	"account/infrastructure"
+	"account/models"
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTakeReadAndCompare(t *testing.T) {
+	accounts := `{"data": [
+		{"id": "1", "organisation_id": "org", "attributes": {"country": "GB", "bank_id": "400302", "account_number": "10000001"}},
+		{"id": "2", "organisation_id": "org", "attributes": {"country": "GB", "bank_id": "400302", "account_number": "10000002"}},
+		{"id": "3", "organisation_id": "other", "attributes": {"country": "FR"}}
+	]}`
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(accounts))
+	})
+	s := httptest.NewServer(h)
+	defer s.Close()
+	u, _ := url.Parse(s.URL)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	service := account.NewService(infrastructure.NewHTTP(ctx, s.Client(), u, ""))
+
+	var before bytes.Buffer
+	if n, err := Take(ctx, service, &before, "org", 100); err != nil || n != 2 {
+		t.Fatalf("Take returned %d, %v, expected the 2 accounts in org", n, err)
+	}
+
+	accounts = `{"data": [
+		{"id": "2", "organisation_id": "org", "attributes": {"country": "GB", "bank_id": "400303", "account_number": "10000002"}},
+		{"id": "4", "organisation_id": "org", "attributes": {"country": "GB", "bank_id": "400302", "account_number": "10000004"}}
+	]}`
+	var after bytes.Buffer
+	if _, err := Take(ctx, service, &after, "org", 100); err != nil {
+		t.Fatalf("Take failed with error: %v", err)
+	}
+
+	old, err := Read(&before)
+	if err != nil || old.Header.Version != Version || old.Header.OrganisationID != "org" || len(old.Accounts) != 2 {
+		t.Fatalf("Read returned %+v, %v, expected the 2 accounts in org", old, err)
+	}
+	new, _ := Read(&after)
+
+	var text strings.Builder
+	Compare(old, new).WriteText(&text)
+	want := `+ 4 GB 400302 10000004
+- 1 GB 400302 10000001
+~ 2
+    bank_id: "400302" -> "400303"
+1 added, 1 removed, 1 modified
+`
+	if text.String() != want {
+		t.Errorf("WriteText wrote %q, expected %q", text.String(), want)
+	}
+
+	if _, err := Read(strings.NewReader(`{"snapshot_version": 2}`)); err == nil {
+		t.Error("Read of a newer snapshot version succeeded, expected an error")
+	}
+}
+
+func TestReadStrictDecoding(t *testing.T) {
+	in := `{"snapshot_version":1}` + "\n" + `{"id":"1","attributes":{"country":"UK"}}` + "\n"
+	if _, err := Read(strings.NewReader(in)); err != nil {
+		t.Errorf("Read failed with error: %v, expected the unknown country as is", err)
+	}
+	var unknown *models.UnknownValueError
+	if _, err := Read(strings.NewReader(in), models.StrictDecoding()); !errors.As(err, &unknown) || unknown.Value != "UK" {
+		t.Errorf("strict Read returned %v, expected an unknown country error", err)
+	}
+}
@@ -0,0 +1,119 @@
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"sync"
+	"time"
+)
+
+type (
+	// Recorder - a Tracer that keeps finished spans in memory so tests can
+	// assert on them without a collector
+	Recorder struct {
+		mu    sync.Mutex
+		spans []*RecordedSpan
+	}
+
+	// RecordedSpan - a span started by a Recorder
+	RecordedSpan struct {
+		Name       string
+		Context    SpanContext
+		Parent     SpanContext
+		Attributes map[string]interface{}
+		Err        error
+		Start      time.Time
+		Finish     time.Time
+
+		recorder *Recorder
+		mu       sync.Mutex
+		ended    bool
+	}
+)
+
+// NewRecorder - returns an empty recorder
+func NewRecorder() *Recorder {
+	return &Recorder{}
+}
+
+// Start - see Tracer. The span continues the trace ctx carries, if any
+func (r *Recorder) Start(ctx context.Context, name string) (context.Context, Span) {
+	parent, _ := SpanContextFromContext(ctx)
+	sc := SpanContext{
+		TraceID:    parent.TraceID,
+		Sampled:    true,
+		TraceState: parent.TraceState,
+	}
+	if !parent.IsValid() {
+		rand.Read(sc.TraceID[:])
+	}
+	rand.Read(sc.SpanID[:])
+
+	span := &RecordedSpan{
+		Name:       name,
+		Context:    sc,
+		Parent:     parent,
+		Attributes: map[string]interface{}{},
+		Start:      time.Now(),
+		recorder:   r,
+	}
+	return ContextWithSpan(ctx, span), span
+}
+
+// Spans - the spans that have ended, in the order they ended
+func (r *Recorder) Spans() []*RecordedSpan {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	spans := make([]*RecordedSpan, len(r.spans))
+	copy(spans, r.spans)
+	return spans
+}
+
+// Reset - forget every span recorded so far
+func (r *Recorder) Reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.spans = nil
+}
+
+// SpanContext - see Span
+func (s *RecordedSpan) SpanContext() SpanContext {
+	return s.Context
+}
+
+// SetAttribute - see Span
+func (s *RecordedSpan) SetAttribute(key string, value interface{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Attributes[key] = value
+}
+
+// Attribute - the value of an attribute set on the span
+func (s *RecordedSpan) Attribute(key string) interface{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.Attributes[key]
+}
+
+// RecordError - see Span
+func (s *RecordedSpan) RecordError(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Err = err
+}
+
+// End - see Span, only the first call counts
+func (s *RecordedSpan) End() {
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.Finish = time.Now()
+	s.mu.Unlock()
+
+	s.recorder.mu.Lock()
+	defer s.recorder.mu.Unlock()
+	s.recorder.spans = append(s.recorder.spans, s)
+}
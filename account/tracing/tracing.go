@@ -0,0 +1,128 @@
+// Package tracing - a minimal tracer interface for spans around account api
+// calls along with W3C trace context (traceparent/tracestate) propagation.
+// Adapt your tracing library of choice to Tracer, or use Recorder in tests
+package tracing
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+type (
+	// Tracer - starts spans, the returned context must carry the span
+	// (see ContextWithSpan) so children and outgoing requests can find it
+	Tracer interface {
+		Start(ctx context.Context, name string) (context.Context, Span)
+	}
+
+	// Span - a unit of work being traced
+	Span interface {
+		SpanContext() SpanContext
+		SetAttribute(key string, value interface{})
+		RecordError(err error)
+		End()
+	}
+
+	// SpanContext - what identifies a span across process boundaries
+	SpanContext struct {
+		TraceID    [16]byte
+		SpanID     [8]byte
+		Sampled    bool
+		TraceState string
+	}
+
+	spanKey        struct{}
+	spanContextKey struct{}
+
+	noopTracer struct{}
+	noopSpan   struct {
+		sc SpanContext
+	}
+)
+
+// Noop - a tracer that records nothing, spans it starts still carry the
+// caller's span context so propagation keeps working
+var Noop Tracer = noopTracer{}
+
+// IsValid - both ids are set, all zeros is invalid per the W3C spec
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID != [16]byte{} && sc.SpanID != [8]byte{}
+}
+
+// TraceParent - the value of the traceparent header for this span
+func (sc SpanContext) TraceParent() string {
+	flags := "00"
+	if sc.Sampled {
+		flags = "01"
+	}
+	return fmt.Sprintf("00-%s-%s-%s", hex.EncodeToString(sc.TraceID[:]), hex.EncodeToString(sc.SpanID[:]), flags)
+}
+
+// ParseTraceParent - reads a traceparent header, e.g. one received by the
+// caller's own server, so spans can continue the caller's trace
+func ParseTraceParent(traceParent, traceState string) (SpanContext, error) {
+	parts := strings.Split(strings.TrimSpace(traceParent), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" || len(parts[1]) != 32 || len(parts[2]) != 16 || len(parts[3]) != 2 {
+		return SpanContext{}, fmt.Errorf("invalid traceparent %q", traceParent)
+	}
+	if parts[0] == "00" && len(parts) != 4 {
+		return SpanContext{}, fmt.Errorf("invalid traceparent %q", traceParent)
+	}
+
+	sc := SpanContext{TraceState: traceState}
+	flags, err := hex.DecodeString(parts[3])
+	if err != nil {
+		return SpanContext{}, fmt.Errorf("invalid traceparent %q: %v", traceParent, err)
+	}
+	if _, err := hex.Decode(sc.TraceID[:], []byte(parts[1])); err != nil {
+		return SpanContext{}, fmt.Errorf("invalid traceparent %q: %v", traceParent, err)
+	}
+	if _, err := hex.Decode(sc.SpanID[:], []byte(parts[2])); err != nil {
+		return SpanContext{}, fmt.Errorf("invalid traceparent %q: %v", traceParent, err)
+	}
+	if !sc.IsValid() {
+		return SpanContext{}, errors.New("invalid traceparent, trace and span ids must not be zero")
+	}
+	sc.Sampled = flags[0]&1 == 1
+	return sc, nil
+}
+
+// ContextWithSpan - returns a copy of ctx carrying span
+func ContextWithSpan(ctx context.Context, span Span) context.Context {
+	return context.WithValue(ctx, spanKey{}, span)
+}
+
+// ContextWithSpanContext - returns a copy of ctx carrying a remote span
+// context, spans started from it become its children
+func ContextWithSpanContext(ctx context.Context, sc SpanContext) context.Context {
+	return context.WithValue(ctx, spanContextKey{}, sc)
+}
+
+// SpanFromContext - the span ctx carries, or one that does nothing
+func SpanFromContext(ctx context.Context) Span {
+	if span, ok := ctx.Value(spanKey{}).(Span); ok {
+		return span
+	}
+	sc, _ := ctx.Value(spanContextKey{}).(SpanContext)
+	return noopSpan{sc: sc}
+}
+
+// SpanContextFromContext - the span context of the span ctx carries,
+// falling back to a remote span context
+func SpanContextFromContext(ctx context.Context) (SpanContext, bool) {
+	sc := SpanFromContext(ctx).SpanContext()
+	return sc, sc.IsValid()
+}
+
+func (noopTracer) Start(ctx context.Context, _ string) (context.Context, Span) {
+	span := SpanFromContext(ctx)
+	return ContextWithSpan(ctx, noopSpan{sc: span.SpanContext()}), noopSpan{sc: span.SpanContext()}
+}
+
+func (s noopSpan) SpanContext() SpanContext           { return s.sc }
+func (noopSpan) SetAttribute(_ string, _ interface{}) {}
+func (noopSpan) RecordError(_ error)                  {}
+func (noopSpan) End()                                 {}
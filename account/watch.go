@@ -0,0 +1,213 @@
+package account
+
+import (
+	"account/internal/atomicfile"
+	"account/models"
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"sort"
+	"time"
+)
+
+// Event types
+const (
+	AccountCreated  EventType = "created"
+	AccountModified EventType = "modified"
+	AccountDeleted  EventType = "deleted"
+)
+
+type (
+	// EventType - what happened to an account between two polls
+	EventType string
+
+	// Event - a change Watch saw. Deleted accounts only carry their id,
+	// version and modified_on
+	Event struct {
+		Type    EventType
+		Account models.Account
+	}
+
+	// WatchOptions - how Watch polls
+	WatchOptions struct {
+		// Cursor - where what was last seen is kept, so a restarted watch
+		// only reports what changed since. Without one every account is
+		// reported as created on the first poll
+		Cursor CursorStore
+		// IgnoreExisting - when there's no saved cursor, take the accounts
+		// the first poll finds as the starting point rather than reporting
+		// them as created
+		IgnoreExisting bool
+		// PageSize - accounts fetched at a time, defaults to 100
+		PageSize int
+		// Buffer - events held before Watch stops polling to wait for the
+		// reader, defaults to 0
+		Buffer int
+		// OnError - called when a poll fails, the watch carries on
+		OnError func(error)
+	}
+
+	// Cursor - the version and modified_on of every account seen
+	Cursor struct {
+		Polled   time.Time              `json:"polled"`
+		Accounts map[string]CursorEntry `json:"accounts"`
+	}
+
+	// CursorEntry - what an account looked like when it was last seen
+	CursorEntry struct {
+		Version    int32            `json:"version"`
+		ModifiedOn models.Timestamp `json:"modified_on"`
+	}
+
+	// CursorStore - loads and saves the cursor of a watch. Load returns a
+	// nil cursor when none has been saved
+	CursorStore interface {
+		Load() (*Cursor, error)
+		Save(c *Cursor) error
+	}
+
+	// FileCursor - a CursorStore keeping the cursor in a json file
+	FileCursor string
+)
+
+// Watch - polls the account api every interval and sends an event for
+// every account created, modified (version or modified_on changed) or
+// deleted since the last poll. Sending waits for the reader, so a slow
+// reader slows the polling down rather than events piling up. The cursor
+// is saved once a poll's events are all sent. The channel is closed once
+// ctx is done
+func (s *Service) Watch(ctx context.Context, interval time.Duration, opts WatchOptions) (<-chan Event, error) {
+	if interval <= 0 {
+		return nil, errors.New("interval argument must be greater than 0")
+	}
+	var cursor *Cursor
+	if opts.Cursor != nil {
+		var err error
+		if cursor, err = opts.Cursor.Load(); err != nil {
+			return nil, err
+		}
+	}
+	quiet := false
+	if cursor == nil {
+		cursor = &Cursor{Accounts: map[string]CursorEntry{}}
+		quiet = opts.IgnoreExisting
+	}
+	if opts.PageSize <= 0 {
+		opts.PageSize = 100
+	}
+
+	events := make(chan Event, opts.Buffer)
+	go func() {
+		defer close(events)
+		t := time.NewTicker(interval)
+		defer t.Stop()
+		for {
+			err := s.poll(ctx, cursor, opts.PageSize, quiet, events)
+			if err == nil && opts.Cursor != nil {
+				err = opts.Cursor.Save(cursor)
+			}
+			if ctx.Err() != nil {
+				return
+			}
+			if err != nil && opts.OnError != nil {
+				opts.OnError(err)
+			}
+			if err == nil {
+				quiet = false
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-t.C:
+			}
+		}
+	}()
+	return events, nil
+}
+
+// poll - walks the accounts, sending events as it goes. Deletions are only
+// worked out, in id order, when the walk gets through every account. The
+// cursor is only updated once the whole poll succeeds, so a failed poll's
+// events are sent again by the next
+func (s *Service) poll(ctx context.Context, cursor *Cursor, pageSize int, quiet bool, events chan<- Event) error {
+	send := func(e Event) error {
+		if quiet {
+			return nil
+		}
+		select {
+		case events <- e:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	polled := time.Now().UTC()
+	seen := make(map[string]CursorEntry, len(cursor.Accounts))
+	err := s.WalkContext(ctx, pageSize, func(a models.Account) error {
+		if _, ok := seen[a.ID]; ok {
+			return nil
+		}
+		entry := CursorEntry{Version: a.Version, ModifiedOn: a.ModifiedOn}
+		seen[a.ID] = entry
+		last, ok := cursor.Accounts[a.ID]
+		switch {
+		case !ok:
+			return send(Event{Type: AccountCreated, Account: a})
+		case last.Version != entry.Version || !last.ModifiedOn.Equal(entry.ModifiedOn.Time):
+			return send(Event{Type: AccountModified, Account: a})
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	var deleted []string
+	for id := range cursor.Accounts {
+		if _, ok := seen[id]; !ok {
+			deleted = append(deleted, id)
+		}
+	}
+	sort.Strings(deleted)
+	for _, id := range deleted {
+		last := cursor.Accounts[id]
+		err := send(Event{Type: AccountDeleted, Account: models.Account{ID: id, Version: last.Version, ModifiedOn: last.ModifiedOn}})
+		if err != nil {
+			return err
+		}
+	}
+	cursor.Accounts, cursor.Polled = seen, polled
+	return nil
+}
+
+// Load - the cursor in the file, nil when there isn't one yet
+func (f FileCursor) Load() (*Cursor, error) {
+	b, err := ioutil.ReadFile(string(f))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	c := &Cursor{}
+	if err := json.Unmarshal(b, c); err != nil {
+		return nil, err
+	}
+	if c.Accounts == nil {
+		c.Accounts = map[string]CursorEntry{}
+	}
+	return c, nil
+}
+
+// Save - replaces the file in one go, a crash never leaves half a cursor
+func (f FileCursor) Save(c *Cursor) error {
+	b, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+	return atomicfile.Write(string(f), b)
+}